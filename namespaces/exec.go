@@ -160,7 +160,9 @@ func SetupCgroups(container *libcontainer.Config, nspid int) (map[string]string,
 }
 
 // InitializeNetworking creates the container's network stack outside of the namespace and moves
-// interfaces into the container's net namespaces if necessary
+// interfaces into the container's net namespaces if necessary.  Every network is recorded in
+// the same networkState so only one of them can add an interface to the container, callers that
+// need several interfaces have to use network.CreateAll with a state per network.
 func InitializeNetworking(container *libcontainer.Config, nspid int, networkState *network.NetworkState) error {
 	for _, config := range container.Networks {
 		strategy, err := network.GetStrategy(config.Type)
@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync/atomic"
 	"syscall"
 	"unsafe"
@@ -20,12 +21,41 @@ const (
 	IFLA_INFO_DATA    = 2
 	VETH_INFO_PEER    = 1
 	IFLA_MACVLAN_MODE = 1
+	IFLA_IPVLAN_MODE  = 1
 	IFLA_VLAN_ID      = 1
 	IFLA_NET_NS_FD    = 28
 	IFLA_ADDRESS      = 1
+	NDA_DST           = 1
+	NDA_LLADDR        = 2
+	NUD_PERMANENT     = 0x80
+	FRA_DST           = 1
+	FRA_SRC           = 2
+	FRA_PRIORITY      = 6
+	FRA_TABLE         = 15
+	FR_ACT_TO_TBL     = 1
+	RTNH_F_ONLINK     = 0x4
+	IFF_LOWER_UP      = 0x10000
+	IF_OPER_UNKNOWN   = 0
+	IF_OPER_UP        = 6
 	SIOC_BRADDBR      = 0x89a0
 	SIOC_BRDELBR      = 0x89a1
 	SIOC_BRADDIF      = 0x89a2
+	SIOCETHTOOL       = 0x8946
+)
+
+const (
+	ETHTOOL_GRXCSUM = 0x14
+	ETHTOOL_SRXCSUM = 0x15
+	ETHTOOL_GTXCSUM = 0x16
+	ETHTOOL_STXCSUM = 0x17
+	ETHTOOL_GSG     = 0x18
+	ETHTOOL_SSG     = 0x19
+	ETHTOOL_GTSO    = 0x1e
+	ETHTOOL_STSO    = 0x1f
+	ETHTOOL_GGSO    = 0x23
+	ETHTOOL_SGSO    = 0x24
+	ETHTOOL_GGRO    = 0x2b
+	ETHTOOL_SGRO    = 0x2c
 )
 
 const (
@@ -35,6 +65,11 @@ const (
 	MACVLAN_MODE_PASSTHRU
 )
 
+const (
+	IPVLAN_MODE_L2 = iota
+	IPVLAN_MODE_L3
+)
+
 var nextSeqNr uint32
 
 type ifreqHwaddr struct {
@@ -52,6 +87,17 @@ type ifreqFlags struct {
 	Ifruflags uint16
 }
 
+type ifreqData struct {
+	IfrnName [IFNAMSIZ]byte
+	IfruData unsafe.Pointer
+	_        [16]byte
+}
+
+type ethtoolValue struct {
+	Cmd  uint32
+	Data uint32
+}
+
 var native binary.ByteOrder
 
 func init() {
@@ -173,6 +219,36 @@ func (msg *RtMsg) Len() int {
 	return syscall.SizeofRtMsg
 }
 
+const sizeofNdMsg = 12
+
+type NdMsg struct {
+	Family uint8
+	Index  int32
+	State  uint16
+	Flags  uint8
+	Type   uint8
+}
+
+func newNdMsg(family int) *NdMsg {
+	return &NdMsg{
+		Family: uint8(family),
+	}
+}
+
+func (msg *NdMsg) ToWireFormat() []byte {
+	b := make([]byte, sizeofNdMsg)
+	b[0] = msg.Family
+	native.PutUint32(b[4:8], uint32(msg.Index))
+	native.PutUint16(b[8:10], msg.State)
+	b[10] = msg.Flags
+	b[11] = msg.Type
+	return b
+}
+
+func (msg *NdMsg) Len() int {
+	return sizeofNdMsg
+}
+
 func rtaAlignOf(attrlen int) int {
 	return (attrlen + syscall.RTA_ALIGNTO - 1) & ^(syscall.RTA_ALIGNTO - 1)
 }
@@ -506,6 +582,91 @@ func NetworkLinkDown(iface *net.Interface) error {
 	return s.HandleAck(wb.Seq)
 }
 
+// Report whether a network interface is operationally up, which means it is up,
+// has a carrier and its operational state is up.  This is identical to checking
+// for UP,LOWER_UP and state UP in: ip link show $name
+func NetworkLinkIsUp(iface *net.Interface) (bool, error) {
+	s, err := getNetlinkSocket()
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+
+	wb := newNetlinkRequest(syscall.RTM_GETLINK, 0)
+
+	msg := newIfInfomsg(syscall.AF_UNSPEC)
+	msg.Index = int32(iface.Index)
+	wb.AddData(msg)
+
+	if err := s.Send(wb); err != nil {
+		return false, err
+	}
+
+	pid, err := s.GetPid()
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		msgs, err := s.Receive()
+		if err != nil {
+			return false, err
+		}
+		for _, m := range msgs {
+			if err := s.CheckMessage(m, wb.Seq, pid); err != nil {
+				return false, err
+			}
+			if m.Header.Type != syscall.RTM_NEWLINK {
+				continue
+			}
+
+			info := (*syscall.IfInfomsg)(unsafe.Pointer(&m.Data[0:syscall.SizeofIfInfomsg][0]))
+			if info.Flags&syscall.IFF_UP == 0 || info.Flags&IFF_LOWER_UP == 0 {
+				return false, nil
+			}
+
+			attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+			if err != nil {
+				return false, err
+			}
+			for _, attr := range attrs {
+				if attr.Attr.Type == syscall.IFLA_OPERSTATE && len(attr.Value) > 0 {
+					// devices that do not track their state report it as unknown
+					state := attr.Value[0]
+					return state == IF_OPER_UP || state == IF_OPER_UNKNOWN, nil
+				}
+			}
+			return true, nil
+		}
+	}
+}
+
+// Enable or disable promiscuous mode on a particular network interface.
+// This is identical to running: ip link set dev $name promisc on|off
+func NetworkSetPromiscMode(iface *net.Interface, enabled bool) error {
+	s, err := getNetlinkSocket()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	wb := newNetlinkRequest(syscall.RTM_NEWLINK, syscall.NLM_F_ACK)
+
+	msg := newIfInfomsg(syscall.AF_UNSPEC)
+	msg.Index = int32(iface.Index)
+	if enabled {
+		msg.Flags = syscall.IFF_PROMISC
+	}
+	msg.Change = syscall.IFF_PROMISC
+	wb.AddData(msg)
+
+	if err := s.Send(wb); err != nil {
+		return err
+	}
+
+	return s.HandleAck(wb.Seq)
+}
+
 // Set link layer address ie. MAC Address.
 // This is identical to running: ip link set dev $name address $macaddress
 func NetworkSetMacAddress(iface *net.Interface, macaddr string) error {
@@ -839,6 +1000,53 @@ func NetworkLinkAddMacVlan(masterDev, macVlanDev string, mode string) error {
 	return s.HandleAck(wb.Seq)
 }
 
+// Add IP VLAN network interface with masterDev as its upper device
+// This is identical to running:
+// ip link add name $name link $masterdev type ipvlan mode $mode
+func NetworkLinkAddIpVlan(masterDev, ipVlanDev string, mode string) error {
+	s, err := getNetlinkSocket()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ipVlan := map[string]uint16{
+		"l2": IPVLAN_MODE_L2,
+		"l3": IPVLAN_MODE_L3,
+	}
+	ipVlanMode, ok := ipVlan[mode]
+	if !ok {
+		return fmt.Errorf("invalid ipvlan mode %q", mode)
+	}
+
+	wb := newNetlinkRequest(syscall.RTM_NEWLINK, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL|syscall.NLM_F_ACK)
+
+	masterDevIfc, err := net.InterfaceByName(masterDev)
+	if err != nil {
+		return err
+	}
+
+	msg := newIfInfomsg(syscall.AF_UNSPEC)
+	wb.AddData(msg)
+
+	nest1 := newRtAttr(syscall.IFLA_LINKINFO, nil)
+	newRtAttrChild(nest1, IFLA_INFO_KIND, nonZeroTerminated("ipvlan"))
+
+	nest2 := newRtAttrChild(nest1, IFLA_INFO_DATA, nil)
+	ipVlanData := make([]byte, 2)
+	native.PutUint16(ipVlanData, ipVlanMode)
+	newRtAttrChild(nest2, IFLA_IPVLAN_MODE, ipVlanData)
+	wb.AddData(nest1)
+
+	wb.AddData(uint32Attr(syscall.IFLA_LINK, uint32(masterDevIfc.Index)))
+	wb.AddData(newRtAttr(syscall.IFLA_IFNAME, zeroTerminated(ipVlanDev)))
+
+	if err := s.Send(wb); err != nil {
+		return err
+	}
+	return s.HandleAck(wb.Seq)
+}
+
 func networkLinkIpAction(action, flags int, ifa IfAddr) error {
 	s, err := getNetlinkSocket()
 	if err != nil {
@@ -896,6 +1104,40 @@ func NetworkLinkAddIp(iface *net.Interface, ip net.IP, ipNet *net.IPNet) error {
 	)
 }
 
+// Add a permanent neighbor (ARP or NDP) entry to an interface. This is identical to:
+// ip neigh replace $ip lladdr $hwaddr dev $iface nud permanent
+func NetworkAddNeighbor(iface *net.Interface, ip net.IP, hwaddr net.HardwareAddr) error {
+	s, err := getNetlinkSocket()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	family := getIpFamily(ip)
+
+	wb := newNetlinkRequest(syscall.RTM_NEWNEIGH, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE|syscall.NLM_F_ACK)
+
+	msg := newNdMsg(family)
+	msg.Index = int32(iface.Index)
+	msg.State = NUD_PERMANENT
+	wb.AddData(msg)
+
+	var ipData []byte
+	if family == syscall.AF_INET {
+		ipData = ip.To4()
+	} else {
+		ipData = ip.To16()
+	}
+	wb.AddData(newRtAttr(NDA_DST, ipData))
+	wb.AddData(newRtAttr(NDA_LLADDR, []byte(hwaddr)))
+
+	if err := s.Send(wb); err != nil {
+		return err
+	}
+
+	return s.HandleAck(wb.Seq)
+}
+
 // Returns an array of IPNet for all the currently routed subnets on ipv4
 // This is similar to the first column of "ip route" output
 func NetworkGetRoutes() ([]Route, error) {
@@ -990,6 +1232,16 @@ outer:
 
 // Add a new route table entry.
 func AddRoute(destination, source, gateway, device string) error {
+	return addRoute(destination, source, gateway, device, 0, 0, false)
+}
+
+// Add a new route table entry to the given routing table.  This is identical to:
+// ip route add $destination via $gateway dev $device metric $metric table $table
+func AddRouteTable(destination, source, gateway, device string, metric, table int) error {
+	return addRoute(destination, source, gateway, device, metric, table, false)
+}
+
+func addRoute(destination, source, gateway, device string, metric, table int, onLink bool) error {
 	if destination == "" && source == "" && gateway == "" {
 		return fmt.Errorf("one of destination, source or gateway must not be blank")
 	}
@@ -1066,6 +1318,19 @@ func AddRoute(destination, source, gateway, device string) error {
 		rtAttrs = append(rtAttrs, newRtAttr(syscall.RTA_GATEWAY, gwData))
 	}
 
+	if onLink {
+		msg.Flags |= RTNH_F_ONLINK
+	}
+
+	if table > 0 {
+		// tables above 255 only fit in the RTA_TABLE attribute
+		if table < 256 {
+			msg.Table = uint8(table)
+		} else {
+			msg.Table = syscall.RT_TABLE_UNSPEC
+		}
+	}
+
 	wb.AddData(msg)
 	for _, attr := range rtAttrs {
 		wb.AddData(attr)
@@ -1077,18 +1342,178 @@ func AddRoute(destination, source, gateway, device string) error {
 	}
 	wb.AddData(uint32Attr(syscall.RTA_OIF, uint32(iface.Index)))
 
+	if metric > 0 {
+		wb.AddData(uint32Attr(syscall.RTA_PRIORITY, uint32(metric)))
+	}
+
+	if table > 0 {
+		wb.AddData(uint32Attr(syscall.RTA_TABLE, uint32(table)))
+	}
+
+	if err := s.Send(wb); err != nil {
+		return err
+	}
+	return s.HandleAck(wb.Seq)
+}
+
+// Delete the IPv4 and IPv6 default routes of the main table that leave through the device.
+// This is identical to running, until no route is left:
+// ip route del default dev $device && ip -6 route del default dev $device
+func DelDefaultRoutes(device string) error {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return err
+	}
+
+	s, err := getNetlinkSocket()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6} {
+		for {
+			wb := newNetlinkRequest(syscall.RTM_DELROUTE, syscall.NLM_F_ACK)
+
+			// match default routes of any type, scope and protocol
+			msg := newRtMsg()
+			msg.Family = uint8(family)
+			msg.Scope = syscall.RT_SCOPE_NOWHERE
+			msg.Protocol = syscall.RTPROT_UNSPEC
+			msg.Type = syscall.RTN_UNSPEC
+			wb.AddData(msg)
+			wb.AddData(uint32Attr(syscall.RTA_OIF, uint32(iface.Index)))
+
+			if err := s.Send(wb); err != nil {
+				return err
+			}
+			if err := s.HandleAck(wb.Seq); err != nil {
+				if err == syscall.ESRCH {
+					break
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Add a new routing policy rule looking up the given table for traffic from
+// and/or to the given networks.  This is identical to:
+// ip rule add from $from to $to table $table priority $priority
+func AddRule(from, to string, table, priority int) error {
+	return ruleAction(syscall.RTM_NEWRULE, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL|syscall.NLM_F_ACK, from, to, table, priority)
+}
+
+// Delete a routing policy rule.  This is identical to:
+// ip rule del from $from to $to table $table priority $priority
+func DelRule(from, to string, table, priority int) error {
+	return ruleAction(syscall.RTM_DELRULE, syscall.NLM_F_ACK, from, to, table, priority)
+}
+
+func ruleAction(action, flags int, from, to string, table, priority int) error {
+	if from == "" && to == "" {
+		return fmt.Errorf("one of from or to must not be blank")
+	}
+	if table <= 0 {
+		return fmt.Errorf("table %d is not valid", table)
+	}
+
+	s, err := getNetlinkSocket()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	wb := newNetlinkRequest(action, flags)
+
+	// the fib rule header has the same layout as rtmsg
+	msg := &RtMsg{}
+	msg.Type = FR_ACT_TO_TBL
+	if table < 256 {
+		msg.Table = uint8(table)
+	}
+	currentFamily := -1
+	var rtAttrs []*RtAttr
+
+	for _, selector := range []struct {
+		cidr     string
+		attrType int
+		length   *uint8
+	}{
+		{from, FRA_SRC, &msg.Src_len},
+		{to, FRA_DST, &msg.Dst_len},
+	} {
+		if selector.cidr == "" {
+			continue
+		}
+		ip, ipNet, err := parseCIDROrIP(selector.cidr)
+		if err != nil {
+			return err
+		}
+		family := getIpFamily(ip)
+		if currentFamily != -1 && currentFamily != family {
+			return fmt.Errorf("from and to ip were not the same IP family")
+		}
+		currentFamily = family
+		ones, _ := ipNet.Mask.Size()
+		*selector.length = uint8(ones)
+
+		var ipData []byte
+		if family == syscall.AF_INET {
+			ipData = ipNet.IP.To4()
+		} else {
+			ipData = ipNet.IP.To16()
+		}
+		rtAttrs = append(rtAttrs, newRtAttr(selector.attrType, ipData))
+	}
+	msg.Family = uint8(currentFamily)
+
+	wb.AddData(msg)
+	for _, attr := range rtAttrs {
+		wb.AddData(attr)
+	}
+	wb.AddData(uint32Attr(FRA_TABLE, uint32(table)))
+	if priority > 0 {
+		wb.AddData(uint32Attr(FRA_PRIORITY, uint32(priority)))
+	}
+
 	if err := s.Send(wb); err != nil {
 		return err
 	}
 	return s.HandleAck(wb.Seq)
 }
 
+// parseCIDROrIP parses s as a CIDR, treating a plain IP as a single host network
+func parseCIDROrIP(s string) (net.IP, *net.IPNet, error) {
+	if ip, ipNet, err := net.ParseCIDR(s); err == nil {
+		return ip, ipNet, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, nil, fmt.Errorf("%s is neither an IP nor a CIDR", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+	return ip, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
 // Add a new default gateway. Identical to:
 // ip route add default via $ip
 func AddDefaultGw(ip, device string) error {
 	return AddRoute("", "", ip, device)
 }
 
+// Add a new default gateway that is used even when it is not within the subnet
+// of the device's addresses. Identical to:
+// ip route add default via $ip dev $device onlink
+func AddDefaultGwOnLink(ip, device string) error {
+	return addRoute("", "", ip, device, 0, 0, true)
+}
+
 // THIS CODE DOES NOT COMMUNICATE WITH KERNEL VIA RTNETLINK INTERFACE
 // IT IS HERE FOR BACKWARDS COMPATIBILITY WITH OLDER LINUX KERNELS
 // WHICH SHIP WITH OLDER NOT ENTIRELY FUNCTIONAL VERSION OF NETLINK
@@ -1225,6 +1650,90 @@ func SetMacAddress(name, addr string) error {
 	return nil
 }
 
+// offloads maps the offload features that can be toggled to their
+// ethtool get and set commands
+var offloads = map[string]struct{ get, set uint32 }{
+	"rx":  {ETHTOOL_GRXCSUM, ETHTOOL_SRXCSUM},
+	"tx":  {ETHTOOL_GTXCSUM, ETHTOOL_STXCSUM},
+	"sg":  {ETHTOOL_GSG, ETHTOOL_SSG},
+	"tso": {ETHTOOL_GTSO, ETHTOOL_STSO},
+	"gso": {ETHTOOL_GGSO, ETHTOOL_SGSO},
+	"gro": {ETHTOOL_GGRO, ETHTOOL_SGRO},
+}
+
+// ethtool issues the ethtool command in value for the interface name,
+// the kernel stores the result of get commands in value
+func ethtool(name string, value *ethtoolValue) error {
+	s, err := getIfSocket()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(s)
+
+	ifr := ifreqData{IfruData: unsafe.Pointer(value)}
+	copy(ifr.IfrnName[:len(ifr.IfrnName)-1], name)
+
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, uintptr(s), SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr))); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// ethtoolSet issues the ethtool set command cmd with data for the
+// interface name.  It is a variable so that tests can stub the ioctl.
+var ethtoolSet = func(name string, cmd, data uint32) error {
+	return ethtool(name, &ethtoolValue{Cmd: cmd, Data: data})
+}
+
+// Returns the names of the offload features that can be toggled with
+// NetworkSetOffload
+func NetworkOffloadFeatures() []string {
+	features := make([]string, 0, len(offloads))
+	for feature := range offloads {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// Enable or disable an offload feature of the interface: rx, tx, sg, tso, gso or gro
+// This is identical to running: ethtool -K $name $feature on|off
+func NetworkSetOffload(iface *net.Interface, feature string, enabled bool) error {
+	if len(iface.Name) >= IFNAMSIZ {
+		return fmt.Errorf("Interface name %s too long", iface.Name)
+	}
+
+	cmds, exists := offloads[feature]
+	if !exists {
+		return fmt.Errorf("Unknown offload feature %s", feature)
+	}
+
+	var data uint32
+	if enabled {
+		data = 1
+	}
+	return ethtoolSet(iface.Name, cmds.set, data)
+}
+
+// Report whether an offload feature of the interface is enabled.
+// This is identical to reading $feature from: ethtool -k $name
+func NetworkGetOffload(iface *net.Interface, feature string) (bool, error) {
+	if len(iface.Name) >= IFNAMSIZ {
+		return false, fmt.Errorf("Interface name %s too long", iface.Name)
+	}
+
+	cmds, exists := offloads[feature]
+	if !exists {
+		return false, fmt.Errorf("Unknown offload feature %s", feature)
+	}
+
+	value := ethtoolValue{Cmd: cmds.get}
+	if err := ethtool(iface.Name, &value); err != nil {
+		return false, err
+	}
+	return value.Data != 0, nil
+}
+
 func SetHairpinMode(iface *net.Interface, enabled bool) error {
 	sysPath := filepath.Join("/sys/class/net", iface.Name, "brport/hairpin_mode")
 
@@ -1,10 +1,16 @@
 package netlink
 
 import (
+	"io"
+	"io/ioutil"
 	"net"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 type testLink struct {
@@ -47,6 +53,21 @@ func downLink(t *testing.T, name string) {
 	}
 }
 
+// net.Interface does not expose IFF_PROMISC so read the kernel flags from sysfs
+func promiscEnabled(t *testing.T, name string) bool {
+	data, err := ioutil.ReadFile(filepath.Join("/sys/class/net", name, "flags"))
+	if err != nil {
+		t.Fatalf("Could not read %s flags: %s", name, err)
+	}
+
+	flags, err := strconv.ParseUint(strings.TrimSpace(string(data)), 0, 32)
+	if err != nil {
+		t.Fatalf("Could not parse %s flags: %s", name, err)
+	}
+
+	return flags&syscall.IFF_PROMISC != 0
+}
+
 func ipAssigned(iface *net.Interface, ip net.IP) bool {
 	addrs, _ := iface.Addrs()
 
@@ -102,6 +123,33 @@ func TestNetworkLinkUpDown(t *testing.T) {
 	}
 }
 
+func TestNetworkSetPromiscMode(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	tl := testLink{name: "tstEth", linkType: "dummy"}
+
+	addLink(t, tl.name, tl.linkType)
+	defer deleteLink(t, tl.name)
+
+	if err := NetworkSetPromiscMode(readLink(t, tl.name), true); err != nil {
+		t.Fatalf("Could not enable promiscuous mode on %#v interface: %s", tl, err)
+	}
+
+	if !promiscEnabled(t, tl.name) {
+		t.Fatalf("Could not enable promiscuous mode on %#v interface", tl)
+	}
+
+	if err := NetworkSetPromiscMode(readLink(t, tl.name), false); err != nil {
+		t.Fatalf("Could not disable promiscuous mode on %#v interface: %s", tl, err)
+	}
+
+	if promiscEnabled(t, tl.name) {
+		t.Fatalf("Could not disable promiscuous mode on %#v interface", tl)
+	}
+}
+
 func TestNetworkSetMacAddress(t *testing.T) {
 	if testing.Short() {
 		return
@@ -248,6 +296,77 @@ func TestNetworkLinkAddMacVlan(t *testing.T) {
 	readLink(t, tl.name)
 }
 
+func TestNetworkLinkAddIpVlan(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	masterLink := testLink{"tstEth", "dummy"}
+
+	addLink(t, masterLink.name, masterLink.linkType)
+	defer deleteLink(t, masterLink.name)
+
+	for _, mode := range []string{"l2", "l3"} {
+		name := "tstIpVlan" + mode
+		if err := NetworkLinkAddIpVlan(masterLink.name, name, mode); err != nil {
+			t.Fatalf("Unable to create %s IP VLAN interface: %s", mode, err)
+		}
+
+		readLink(t, name)
+		deleteLink(t, name)
+	}
+
+	if err := NetworkLinkAddIpVlan(masterLink.name, "tstIpVlan", "l4"); err == nil {
+		t.Fatal("expected error to not be nil with an invalid mode")
+	}
+}
+
+func TestNetworkSetOffload(t *testing.T) {
+	type call struct {
+		name string
+		cmd  uint32
+		data uint32
+	}
+	var calls []call
+
+	orig := ethtoolSet
+	defer func() { ethtoolSet = orig }()
+	ethtoolSet = func(name string, cmd, data uint32) error {
+		calls = append(calls, call{name, cmd, data})
+		return nil
+	}
+
+	iface := &net.Interface{Index: 1, Name: "tstEth"}
+	for _, tt := range []struct {
+		feature string
+		enabled bool
+		want    call
+	}{
+		{"rx", false, call{"tstEth", ETHTOOL_SRXCSUM, 0}},
+		{"tx", true, call{"tstEth", ETHTOOL_STXCSUM, 1}},
+		{"sg", false, call{"tstEth", ETHTOOL_SSG, 0}},
+		{"tso", true, call{"tstEth", ETHTOOL_STSO, 1}},
+		{"gso", false, call{"tstEth", ETHTOOL_SGSO, 0}},
+		{"gro", true, call{"tstEth", ETHTOOL_SGRO, 1}},
+	} {
+		calls = nil
+		if err := NetworkSetOffload(iface, tt.feature, tt.enabled); err != nil {
+			t.Fatal(err)
+		}
+		if len(calls) != 1 || calls[0] != tt.want {
+			t.Fatalf("expected %s to issue %#v but received %#v", tt.feature, tt.want, calls)
+		}
+	}
+
+	calls = nil
+	if err := NetworkSetOffload(iface, "unknown", true); err == nil {
+		t.Fatal("expected error to not be nil for an unknown feature")
+	}
+	if len(calls) != 0 {
+		t.Fatalf("expected no ioctl for an unknown feature but received %#v", calls)
+	}
+}
+
 func TestAddDelNetworkIp(t *testing.T) {
 	if testing.Short() {
 		return
@@ -280,6 +399,47 @@ func TestAddDelNetworkIp(t *testing.T) {
 	}
 }
 
+func TestNdMsgWireFormat(t *testing.T) {
+	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6} {
+		msg := newNdMsg(family)
+		msg.Index = 3
+		msg.State = NUD_PERMANENT
+
+		b := msg.ToWireFormat()
+		if len(b) != msg.Len() {
+			t.Fatalf("Expected %d bytes but got %d", msg.Len(), len(b))
+		}
+		if int(b[0]) != family {
+			t.Fatalf("Expected family %d but got %d", family, b[0])
+		}
+		if index := native.Uint32(b[4:8]); index != 3 {
+			t.Fatalf("Expected index 3 but got %d", index)
+		}
+		if state := native.Uint16(b[8:10]); state != NUD_PERMANENT {
+			t.Fatalf("Expected state %#x but got %#x", NUD_PERMANENT, state)
+		}
+	}
+}
+
+func TestNetworkAddNeighbor(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	tl := testLink{name: "tstEth", linkType: "dummy"}
+	hwaddr, _ := net.ParseMAC("22:ce:e0:99:63:6f")
+
+	addLink(t, tl.name, tl.linkType)
+	defer deleteLink(t, tl.name)
+
+	iface := readLink(t, tl.name)
+	for _, ip := range []string{"10.99.0.2", "fd00::2"} {
+		if err := NetworkAddNeighbor(iface, net.ParseIP(ip), hwaddr); err != nil {
+			t.Fatalf("Could not add neighbor %s to interface %#v: %s", ip, iface, err)
+		}
+	}
+}
+
 func TestAddRouteSourceSelection(t *testing.T) {
 	tstIp := "127.1.1.1"
 	tl := testLink{name: "tstEth", linkType: "dummy"}
@@ -308,6 +468,124 @@ func TestAddRouteSourceSelection(t *testing.T) {
 	}
 }
 
+func TestAddRouteMetric(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	tl := testLink{name: "tstEth", linkType: "dummy"}
+
+	addLink(t, tl.name, tl.linkType)
+	defer deleteLink(t, tl.name)
+
+	upLink(t, tl.name)
+	defer downLink(t, tl.name)
+
+	for _, metric := range []int{100, 200} {
+		if err := AddRouteTable("10.99.0.0/16", "", "", tl.name, metric, 0); err != nil {
+			t.Fatalf("Failed to add route with metric %d: %s", metric, err)
+		}
+	}
+
+	metrics := routeMetrics(t, "10.99.0.0/16")
+	if len(metrics) != 2 || metrics[0] != 100 || metrics[1] != 200 {
+		t.Fatalf("Expected routes with metrics 100 and 200 but received %v", metrics)
+	}
+}
+
+// routeMetrics returns the RTA_PRIORITY of every ipv4 route of the main
+// table to destination
+func routeMetrics(t *testing.T, destination string) []int {
+	s, err := getNetlinkSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	wb := newNetlinkRequest(syscall.RTM_GETROUTE, syscall.NLM_F_DUMP)
+	wb.AddData(newIfInfomsg(syscall.AF_INET))
+	if err := s.Send(wb); err != nil {
+		t.Fatal(err)
+	}
+	pid, err := s.GetPid()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics []int
+	for {
+		msgs, err := s.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range msgs {
+			if err := s.CheckMessage(m, wb.Seq, pid); err != nil {
+				if err == io.EOF {
+					return metrics
+				}
+				t.Fatal(err)
+			}
+			if m.Header.Type != syscall.RTM_NEWROUTE {
+				continue
+			}
+			msg := (*RtMsg)(unsafe.Pointer(&m.Data[0:syscall.SizeofRtMsg][0]))
+			if msg.Table != syscall.RT_TABLE_MAIN || msg.Family != syscall.AF_INET {
+				continue
+			}
+			attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var (
+				dst    string
+				metric int
+			)
+			for _, attr := range attrs {
+				switch attr.Attr.Type {
+				case syscall.RTA_DST:
+					dst = (&net.IPNet{IP: attr.Value, Mask: net.CIDRMask(int(msg.Dst_len), 32)}).String()
+				case syscall.RTA_PRIORITY:
+					metric = int(native.Uint32(attr.Value[0:4]))
+				}
+			}
+			if dst == destination {
+				metrics = append(metrics, metric)
+			}
+		}
+	}
+}
+
+func TestAddRuleAndRouteTable(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	tl := testLink{name: "tstEth", linkType: "dummy"}
+	table := 100
+
+	addLink(t, tl.name, tl.linkType)
+	defer deleteLink(t, tl.name)
+
+	upLink(t, tl.name)
+	defer downLink(t, tl.name)
+
+	if err := AddRouteTable("10.98.0.0/16", "", "", tl.name, 0, table); err != nil {
+		t.Fatalf("Failed to add route to table %d: %s", table, err)
+	}
+
+	if err := AddRule("10.97.0.5", "", table, 1000); err != nil {
+		t.Fatalf("Failed to add rule for table %d: %s", table, err)
+	}
+
+	if err := DelRule("10.97.0.5", "", table, 1000); err != nil {
+		t.Fatalf("Failed to delete rule for table %d: %s", table, err)
+	}
+
+	if err := AddRule("", "", table, 1000); err == nil {
+		t.Fatal("Expected error adding a rule without from or to")
+	}
+}
+
 func TestCreateVethPair(t *testing.T) {
 	if testing.Short() {
 		return
@@ -327,6 +605,44 @@ func TestCreateVethPair(t *testing.T) {
 	readLink(t, name2)
 }
 
+func TestNetworkLinkIsUp(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	var (
+		name1 = "tstup0"
+		name2 = "tstup1"
+	)
+
+	if err := NetworkCreateVethPair(name1, name2, 0); err != nil {
+		t.Fatalf("Could not create veth pair %s %s: %s", name1, name2, err)
+	}
+	defer NetworkLinkDel(name1)
+
+	// a veth only has a carrier once its peer is up as well
+	upLink(t, name1)
+	if up, err := NetworkLinkIsUp(readLink(t, name1)); err != nil || up {
+		t.Fatalf("Expected %s to not be up while its peer is down: %v", name1, err)
+	}
+
+	// the operational state follows the carrier asynchronously
+	upLink(t, name2)
+	for i := 0; ; i++ {
+		up, err := NetworkLinkIsUp(readLink(t, name1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if up {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("Expected %s to be up", name1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 //
 // netlink package tests which do not use RTNETLINK
 //
@@ -19,6 +19,10 @@ func NetworkLinkAdd(name string, linkType string) error {
 	return ErrNotImplemented
 }
 
+func NetworkLinkAddIpVlan(masterDev, ipVlanDev string, mode string) error {
+	return ErrNotImplemented
+}
+
 func NetworkLinkDel(name string) error {
 	return ErrNotImplemented
 }
@@ -27,6 +31,22 @@ func NetworkLinkUp(iface *net.Interface) error {
 	return ErrNotImplemented
 }
 
+func NetworkSetPromiscMode(iface *net.Interface, enabled bool) error {
+	return ErrNotImplemented
+}
+
+func NetworkOffloadFeatures() []string {
+	return nil
+}
+
+func NetworkSetOffload(iface *net.Interface, feature string, enabled bool) error {
+	return ErrNotImplemented
+}
+
+func NetworkGetOffload(iface *net.Interface, feature string) (bool, error) {
+	return false, ErrNotImplemented
+}
+
 func NetworkLinkAddIp(iface *net.Interface, ip net.IP, ipNet *net.IPNet) error {
 	return ErrNotImplemented
 }
@@ -35,14 +55,38 @@ func NetworkLinkDelIp(iface *net.Interface, ip net.IP, ipNet *net.IPNet) error {
 	return ErrNotImplemented
 }
 
+func NetworkAddNeighbor(iface *net.Interface, ip net.IP, hwaddr net.HardwareAddr) error {
+	return ErrNotImplemented
+}
+
 func AddRoute(destination, source, gateway, device string) error {
 	return ErrNotImplemented
 }
 
+func DelDefaultRoutes(device string) error {
+	return ErrNotImplemented
+}
+
+func AddRouteTable(destination, source, gateway, device string, metric, table int) error {
+	return ErrNotImplemented
+}
+
+func AddRule(from, to string, table, priority int) error {
+	return ErrNotImplemented
+}
+
+func DelRule(from, to string, table, priority int) error {
+	return ErrNotImplemented
+}
+
 func AddDefaultGw(ip, device string) error {
 	return ErrNotImplemented
 }
 
+func AddDefaultGwOnLink(ip, device string) error {
+	return ErrNotImplemented
+}
+
 func NetworkSetMTU(iface *net.Interface, mtu int) error {
 	return ErrNotImplemented
 }
@@ -75,6 +119,10 @@ func NetworkLinkDown(iface *net.Interface) error {
 	return ErrNotImplemented
 }
 
+func NetworkLinkIsUp(iface *net.Interface) (bool, error) {
+	return false, ErrNotImplemented
+}
+
 func CreateBridge(name string, setMacAddr bool) error {
 	return ErrNotImplemented
 }
@@ -0,0 +1,98 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrBridgeNotSpecified     = errors.New("bridge is not specified")
+	ErrVethPrefixNotSpecified = errors.New("veth prefix is not specified")
+	ErrParentNotSpecified     = errors.New("parent is not specified")
+	ErrVethChildNotSpecified  = errors.New("vethChild is not specified")
+	ErrBridgeNotFound         = errors.New("bridge not found")
+	ErrParentNotFound         = errors.New("parent not found")
+	ErrNamespaceMoveFailed    = errors.New("unable to move interface into the network namespace")
+	ErrAddressConflict        = errors.New("address is already in use")
+)
+
+// Error is returned by the network strategies for failures that callers
+// can act on.  Err is one of the sentinel errors of this package, Detail
+// describes what the failure happened to and Underlying, if set, is the
+// error that caused it.
+type Error struct {
+	Err        error
+	Detail     string
+	Underlying error
+}
+
+func (e *Error) Error() string {
+	if e.Underlying != nil {
+		return fmt.Sprintf("%s: %s: %s", e.Detail, e.Err, e.Underlying)
+	}
+	return fmt.Sprintf("%s: %s", e.Detail, e.Err)
+}
+
+// Unwrap returns the sentinel error so that errors.Is matches it
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// RollbackError is returned by CreateAll when a network fails to be created
+// and the networks created before it can not all be deleted again.  Err is
+// the error of the network that failed and Rollback the errors of deleting
+// the others.
+type RollbackError struct {
+	Err      error
+	Rollback []error
+}
+
+func (e *RollbackError) Error() string {
+	rollback := make([]string, len(e.Rollback))
+	for i, err := range e.Rollback {
+		rollback[i] = err.Error()
+	}
+	return fmt.Sprintf("%s, rollback failed: %s", e.Err, strings.Join(rollback, "; "))
+}
+
+// Unwrap returns the error of the network that failed to be created
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+func newError(err error, format string, v ...interface{}) error {
+	return &Error{
+		Err:    err,
+		Detail: fmt.Sprintf(format, v...),
+	}
+}
+
+// wrapError is like newError for a failure that was caused by underlying
+func wrapError(err, underlying error, format string, v ...interface{}) error {
+	return &Error{
+		Err:        err,
+		Detail:     fmt.Sprintf(format, v...),
+		Underlying: underlying,
+	}
+}
+
+// Cause returns the sentinel error of err if it is an *Error, otherwise
+// err is returned unchanged so it can be compared against the sentinel
+// errors directly.
+func Cause(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Err
+	}
+	return err
+}
+
+// addressError converts the error of assigning address to device into
+// ErrAddressConflict when the address is already in use.
+func addressError(device, address string, err error) error {
+	if os.IsExist(err) {
+		return wrapError(ErrAddressConflict, err, "set %s ip %s", device, address)
+	}
+	return fmt.Errorf("set %s ip %s %s", device, address, err)
+}
@@ -0,0 +1,59 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCause(t *testing.T) {
+	err := newError(ErrBridgeNotFound, "bridge %s", "br0")
+	if Cause(err) != ErrBridgeNotFound {
+		t.Fatalf("expected cause to be %q but received %q", ErrBridgeNotFound, Cause(err))
+	}
+	if expected := "bridge br0: bridge not found"; err.Error() != expected {
+		t.Fatalf("expected error to be %q but received %q", expected, err)
+	}
+
+	other := errors.New("other")
+	if Cause(other) != other {
+		t.Fatalf("expected cause of an unknown error to be itself but received %q", Cause(other))
+	}
+	if Cause(nil) != nil {
+		t.Fatal("expected cause of nil to be nil")
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	for _, sentinel := range []error{
+		ErrBridgeNotFound,
+		ErrParentNotFound,
+		ErrNamespaceMoveFailed,
+		ErrAddressConflict,
+	} {
+		if err := newError(sentinel, "interface %s", "eth0"); !errors.Is(err, sentinel) {
+			t.Fatalf("expected %q to match %q", err, sentinel)
+		}
+		if err := wrapError(sentinel, syscall.ESRCH, "interface %s", "eth0"); !errors.Is(err, sentinel) {
+			t.Fatalf("expected %q to match %q", err, sentinel)
+		}
+	}
+	if err := newError(ErrBridgeNotFound, "bridge %s", "br0"); errors.Is(err, ErrParentNotFound) {
+		t.Fatalf("expected %q to not match %q", err, ErrParentNotFound)
+	}
+}
+
+func TestWrapErrorKeepsUnderlying(t *testing.T) {
+	err := addressError("eth0", "10.0.0.2/24", syscall.EEXIST)
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error but received %T", err)
+	}
+	if e.Underlying != syscall.EEXIST || !os.IsExist(e.Underlying) {
+		t.Fatalf("expected the underlying error to be kept but received %v", e.Underlying)
+	}
+	if expected := "set eth0 ip 10.0.0.2/24: address is already in use: file exists"; err.Error() != expected {
+		t.Fatalf("expected error to be %q but received %q", expected, err)
+	}
+}
@@ -0,0 +1,86 @@
+// +build linux
+
+package network
+
+import (
+	"fmt"
+	"net"
+)
+
+// Ipvlan is a network strategy that creates an ipvlan interface on top
+// of a parent interface on the host and places it inside the container's
+// namespace.  ipvlan interfaces share the mac address of their parent
+type Ipvlan struct {
+}
+
+const (
+	defaultIpvlanMode   = "l2"
+	defaultIpvlanPrefix = "ipv"
+)
+
+// createIpvlan creates the ipvlan link and is replaced in tests that run
+// without ipvlan support
+var createIpvlan = CreateIpvlan
+
+func (i *Ipvlan) Create(n *Network, nspid int, networkState *NetworkState) error {
+	var (
+		parent = n.Parent
+		prefix = n.VethPrefix
+		mode   = n.IpvlanMode
+	)
+	if parent == "" {
+		return ErrParentNotSpecified
+	}
+	if prefix == "" {
+		prefix = defaultIpvlanPrefix
+	}
+	if mode == "" {
+		mode = defaultIpvlanMode
+	}
+	if n.MacAddress != "" || n.DeriveMacFromID {
+		return fmt.Errorf("mac address cannot be set on an ipvlan interface")
+	}
+	if err := n.Validate(); err != nil {
+		return err
+	}
+	if _, err := net.InterfaceByName(parent); err != nil {
+		return newError(ErrParentNotFound, "parent %s", parent)
+	}
+	name, err := createLink(prefix, n.VethSuffixLength, func(name string) error {
+		return createIpvlan(parent, name, mode)
+	})
+	if err != nil {
+		return err
+	}
+	networkState.VethChild = name
+	networkState.Interface = interfaceName(n)
+	recordDNS(n, networkState)
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	networkState.VethChildIndex = iface.Index
+
+	// an ipvlan already uses the mtu of its parent
+	if n.Mtu != 0 && n.Mtu != InheritBridgeMtu {
+		if err := SetMtu(name, n.Mtu); err != nil {
+			return err
+		}
+	}
+	if err := moveToNamespace(iface.Index, name, n, nspid); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (i *Ipvlan) Initialize(config *Network, networkState *NetworkState) error {
+	return initializeInterface(config, networkState)
+}
+
+// Delete removes the ipvlan interface recorded in the network state if it is still on
+// the host.  Once it has been moved into the container it is removed together with
+// the container's network namespace.
+func (i *Ipvlan) Delete(n *Network, networkState *NetworkState) error {
+	return deleteHostInterface(networkState.VethChild)
+}
@@ -0,0 +1,139 @@
+// +build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIpvlanCreateValidation(t *testing.T) {
+	i := &Ipvlan{}
+
+	for _, n := range []*Network{
+		{},
+		{Parent: "parentmissing0"},
+		{Parent: "lo", IpvlanMode: "l4"},
+		{Parent: "lo", MacAddress: "02:42:ac:11:00:02"},
+	} {
+		state := &NetworkState{}
+		if err := i.Create(n, 1, state); err == nil {
+			t.Fatalf("expected error to not be nil for %#v", n)
+		}
+		if state.VethChild != "" {
+			t.Fatalf("expected no ipvlan to be created for %#v", n)
+		}
+	}
+}
+
+func TestIpvlanCreateWithMissingParent(t *testing.T) {
+	s := &Ipvlan{}
+
+	if err := s.Create(&Network{}, 1, &NetworkState{}); err != ErrParentNotSpecified {
+		t.Fatalf("expected error to be %q but received %v", ErrParentNotSpecified, err)
+	}
+	if err := s.Create(&Network{Parent: "parentmissing0"}, 1, &NetworkState{}); !errors.Is(err, ErrParentNotFound) {
+		t.Fatalf("expected error to be %q but received %v", ErrParentNotFound, err)
+	}
+}
+
+func TestIpvlanCreate(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	parent, _, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(parent)
+
+	if err := CreateIpvlan(parent, "ipvtest0", defaultIpvlanMode); err != nil {
+		t.Skipf("ipvlan is not supported: %s", err)
+	}
+	DeleteInterface("ipvtest0")
+
+	// a process in its own network namespace to move the ipvlan into
+	cmd := exec.Command("unshare", "-n", "sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("unable to start a process in a new network namespace: %s", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	ipvlan := &Ipvlan{}
+	for _, mode := range []string{"l2", "l3"} {
+		n := &Network{
+			Parent:     parent,
+			IpvlanMode: mode,
+		}
+
+		state := &NetworkState{}
+		if err := ipvlan.Create(n, cmd.Process.Pid, state); err != nil {
+			t.Fatalf("unable to create %s ipvlan: %s", mode, err)
+		}
+		if state.VethChild == "" || state.Interface != defaultDevice {
+			t.Fatalf("expected state to be recorded but received %#v", state)
+		}
+
+		// the ipvlan must have been moved out of the host namespace
+		if _, err := net.InterfaceByName(state.VethChild); err == nil {
+			t.Fatalf("expected %s to be moved into the namespace", state.VethChild)
+		}
+	}
+}
+
+func TestIpvlanCreateAndInitialize(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	// a veth stands in for the ipvlan so that the test runs without ipvlan support
+	var parent, mode string
+	createIpvlan = func(p, name, m string) error {
+		parent, mode = p, m
+		_, peer, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		return ChangeInterfaceName(peer, name)
+	}
+	defer func() { createIpvlan = CreateIpvlan }()
+
+	n := &Network{
+		Type:          "ipvlan",
+		Parent:        "lo",
+		IpvlanMode:    "l3",
+		InterfaceName: "ipvtest0",
+	}
+	err := inNewNetworkNamespace(func() error {
+		// the interface is moved into the namespace it is already in
+		n.NamespacePath = fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid())
+
+		i := &Ipvlan{}
+		state := &NetworkState{}
+		if err := i.Create(n, 1<<30, state); err != nil {
+			return err
+		}
+		if err := i.Initialize(n, state); err != nil {
+			return err
+		}
+		_, err := net.InterfaceByName(n.InterfaceName)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent != n.Parent || mode != n.IpvlanMode {
+		t.Fatalf("expected ipvlan on %s in mode %s but received %s in mode %s", n.Parent, n.IpvlanMode, parent, mode)
+	}
+}
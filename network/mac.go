@@ -0,0 +1,17 @@
+package network
+
+import (
+	"crypto/sha256"
+	"net"
+)
+
+// GenerateMacFromID returns a mac address derived from the id so that the same
+// id always results in the same address.  The address is a locally administered
+// unicast address so it can not collide with the address of a real device.
+func GenerateMacFromID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	hw := net.HardwareAddr(sum[:6])
+	hw[0] &^= 0x1 // clear multicast bit
+	hw[0] |= 0x2  // set local assignment bit (IEEE802)
+	return hw.String()
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestGenerateMacFromID(t *testing.T) {
+	ids := []string{
+		"",
+		"4e6a6e3d1ad5",
+		"4e6a6e3d1ad5b0bb4f4e4ba88b8d6a4d4a2b02cb5cfc3b7c1ad4cbf2a2a1d2f3",
+		"another container",
+	}
+	seen := make(map[string]string)
+	for _, id := range ids {
+		mac := GenerateMacFromID(id)
+		if again := GenerateMacFromID(id); again != mac {
+			t.Fatalf("expected %q to always generate %s but received %s", id, mac, again)
+		}
+		if other, exists := seen[mac]; exists {
+			t.Fatalf("expected %q and %q to generate different mac addresses", id, other)
+		}
+		seen[mac] = id
+
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hw[0]&0x1 != 0 {
+			t.Fatalf("expected %s to be unicast", mac)
+		}
+		if hw[0]&0x2 == 0 {
+			t.Fatalf("expected %s to be locally administered", mac)
+		}
+	}
+}
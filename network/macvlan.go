@@ -0,0 +1,111 @@
+// +build linux
+
+package network
+
+import (
+	"net"
+	"os"
+
+	"github.com/docker/libcontainer/utils"
+)
+
+// Macvlan is a network strategy that creates a macvlan interface on top
+// of a parent interface on the host and places it inside the container's
+// namespace
+type Macvlan struct {
+}
+
+const (
+	defaultMacvlanMode   = "bridge"
+	defaultMacvlanPrefix = "mv"
+)
+
+// createMacvlan creates the macvlan link and is replaced in tests that run
+// without macvlan support
+var createMacvlan = CreateMacvlan
+
+func (m *Macvlan) Create(n *Network, nspid int, networkState *NetworkState) error {
+	var (
+		parent = n.Parent
+		prefix = n.VethPrefix
+		mode   = n.MacvlanMode
+	)
+	if parent == "" {
+		return ErrParentNotSpecified
+	}
+	if prefix == "" {
+		prefix = defaultMacvlanPrefix
+	}
+	if mode == "" {
+		mode = defaultMacvlanMode
+	}
+	if err := n.Validate(); err != nil {
+		return err
+	}
+	if _, err := net.InterfaceByName(parent); err != nil {
+		return newError(ErrParentNotFound, "parent %s", parent)
+	}
+	name, err := createLink(prefix, n.VethSuffixLength, func(name string) error {
+		return createMacvlan(parent, name, mode)
+	})
+	if err != nil {
+		return err
+	}
+	networkState.VethChild = name
+	networkState.Interface = interfaceName(n)
+	recordDNS(n, networkState)
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	networkState.VethChildIndex = iface.Index
+
+	// a macvlan already uses the mtu of its parent
+	if n.Mtu != 0 && n.Mtu != InheritBridgeMtu {
+		if err := SetMtu(name, n.Mtu); err != nil {
+			return err
+		}
+	}
+	if err := moveToNamespace(iface.Index, name, n, nspid); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *Macvlan) Initialize(config *Network, networkState *NetworkState) error {
+	return initializeInterface(config, networkState)
+}
+
+// Delete removes the macvlan interface recorded in the network state if it is still on
+// the host.  Once it has been moved into the container it is removed together with
+// the container's network namespace.
+func (m *Macvlan) Delete(n *Network, networkState *NetworkState) error {
+	return deleteHostInterface(networkState.VethChild)
+}
+
+// createLink will automatically generate a random name for a
+// link on the host and retry create until the name is not in use
+func createLink(prefix string, suffixLength int, create func(name string) error) (name string, err error) {
+	if suffixLength, err = vethSuffixLength(prefix, suffixLength); err != nil {
+		return
+	}
+
+	for i := 0; i < 10; i++ {
+		if name, err = utils.GenerateRandomName(prefix, suffixLength); err != nil {
+			return
+		}
+
+		if err = create(name); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+
+			return
+		}
+
+		break
+	}
+
+	return
+}
@@ -0,0 +1,123 @@
+// +build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestMacvlanCreateValidation(t *testing.T) {
+	m := &Macvlan{}
+
+	for _, n := range []*Network{
+		{},
+		{Parent: "parentmissing0"},
+		{Parent: "lo", MacvlanMode: "unknown"},
+	} {
+		state := &NetworkState{}
+		if err := m.Create(n, 1, state); err == nil {
+			t.Fatalf("expected error to not be nil for %#v", n)
+		}
+		if state.VethChild != "" {
+			t.Fatalf("expected no macvlan to be created for %#v", n)
+		}
+	}
+}
+
+func TestMacvlanCreateWithMissingParent(t *testing.T) {
+	s := &Macvlan{}
+
+	if err := s.Create(&Network{}, 1, &NetworkState{}); err != ErrParentNotSpecified {
+		t.Fatalf("expected error to be %q but received %v", ErrParentNotSpecified, err)
+	}
+	if err := s.Create(&Network{Parent: "parentmissing0"}, 1, &NetworkState{}); !errors.Is(err, ErrParentNotFound) {
+		t.Fatalf("expected error to be %q but received %v", ErrParentNotFound, err)
+	}
+}
+
+func TestMacvlanCreate(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	parent, _, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(parent)
+
+	m := &Macvlan{}
+	for _, mode := range []string{"bridge", "private", "vepa"} {
+		n := &Network{
+			Parent:      parent,
+			MacvlanMode: mode,
+			Mtu:         1400,
+		}
+
+		// the move into the namespace fails but the macvlan is created before that
+		state := &NetworkState{}
+		if err := m.Create(n, 1<<30, state); err == nil {
+			t.Fatal("expected error to not be nil with an invalid pid")
+		}
+
+		iface, err := net.InterfaceByName(state.VethChild)
+		if err != nil {
+			t.Fatalf("expected %s macvlan to be created but received %q", mode, err)
+		}
+		if iface.MTU != n.Mtu {
+			t.Fatalf("expected %s mtu to be %d but received %d", iface.Name, n.Mtu, iface.MTU)
+		}
+		DeleteInterface(state.VethChild)
+	}
+}
+
+func TestMacvlanCreateAndInitialize(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	// a veth stands in for the macvlan so that only the arguments are checked
+	var parent, mode string
+	createMacvlan = func(p, name, m string) error {
+		parent, mode = p, m
+		_, peer, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		return ChangeInterfaceName(peer, name)
+	}
+	defer func() { createMacvlan = CreateMacvlan }()
+
+	n := &Network{
+		Type:          "macvlan",
+		Parent:        "lo",
+		MacvlanMode:   "vepa",
+		InterfaceName: "mvtest0",
+	}
+	err := inNewNetworkNamespace(func() error {
+		// the interface is moved into the namespace it is already in
+		n.NamespacePath = fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid())
+
+		m := &Macvlan{}
+		state := &NetworkState{}
+		if err := m.Create(n, 1<<30, state); err != nil {
+			return err
+		}
+		if err := m.Initialize(n, state); err != nil {
+			return err
+		}
+		_, err := net.InterfaceByName(n.InterfaceName)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent != n.Parent || mode != n.MacvlanMode {
+		t.Fatalf("expected macvlan on %s in mode %s but received %s in mode %s", n.Parent, n.MacvlanMode, parent, mode)
+	}
+}
@@ -3,7 +3,14 @@
 package network
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/docker/libcontainer/netlink"
 )
@@ -32,10 +39,22 @@ func ChangeInterfaceName(old, newName string) error {
 	return netlink.NetworkChangeName(iface, newName)
 }
 
+func DeleteInterface(name string) error {
+	return netlink.NetworkLinkDel(name)
+}
+
 func CreateVethPair(name1, name2 string, txQueueLen int) error {
 	return netlink.NetworkCreateVethPair(name1, name2, txQueueLen)
 }
 
+func CreateMacvlan(parent, name, mode string) error {
+	return netlink.NetworkLinkAddMacVlan(parent, name, mode)
+}
+
+func CreateIpvlan(parent, name, mode string) error {
+	return netlink.NetworkLinkAddIpVlan(parent, name, mode)
+}
+
 func SetInterfaceInNamespacePid(name string, nsPid int) error {
 	iface, err := net.InterfaceByName(name)
 	if err != nil {
@@ -52,6 +71,50 @@ func SetInterfaceInNamespaceFd(name string, fd uintptr) error {
 	return netlink.NetworkSetNsFd(iface, int(fd))
 }
 
+// FindNamespaceByInode returns a path to the network namespace with the given inode
+// by looking through the named namespaces in /var/run/netns and the namespaces of
+// the running processes
+func FindNamespaceByInode(inode uint64) (string, error) {
+	named, _ := filepath.Glob("/var/run/netns/*")
+	procs, _ := filepath.Glob("/proc/[0-9]*/ns/net")
+	for _, path := range append(named, procs...) {
+		// processes can exit while they are being looked at
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Ino == inode {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("network namespace with inode %d not found", inode)
+}
+
+// SetInterfaceIndexInNamespacePid moves the interface with the given index into the
+// network namespace of nsPid without looking it up by name
+func SetInterfaceIndexInNamespacePid(index, nsPid int) error {
+	return netlink.NetworkSetNsPid(&net.Interface{Index: index}, nsPid)
+}
+
+// SetInterfaceIndexInNamespacePath moves the interface with the given index into the
+// network namespace at nsPath without looking it up by name
+func SetInterfaceIndexInNamespacePath(index int, nsPath string) error {
+	f, err := os.OpenFile(nsPath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return netlink.NetworkSetNsFd(&net.Interface{Index: index}, int(f.Fd()))
+}
+
+func CreateBridge(name string, setMacAddr bool) error {
+	return netlink.CreateBridge(name, setMacAddr)
+}
+
+func DeleteBridge(name string) error {
+	return netlink.DeleteBridge(name)
+}
+
 func SetInterfaceMaster(name, master string) error {
 	iface, err := net.InterfaceByName(name)
 	if err != nil {
@@ -68,6 +131,26 @@ func SetDefaultGateway(ip, ifaceName string) error {
 	return netlink.AddDefaultGw(ip, ifaceName)
 }
 
+func SetDefaultGatewayOnLink(ip, ifaceName string) error {
+	return netlink.AddDefaultGwOnLink(ip, ifaceName)
+}
+
+func AddRoute(destination, gateway, ifaceName string, metric, table int) error {
+	return netlink.AddRouteTable(destination, "", gateway, ifaceName, metric, table)
+}
+
+func DeleteDefaultRoutes(ifaceName string) error {
+	return netlink.DelDefaultRoutes(ifaceName)
+}
+
+func AddRule(from, to string, table, priority int) error {
+	return netlink.AddRule(from, to, table, priority)
+}
+
+func DeleteRule(from, to string, table, priority int) error {
+	return netlink.DelRule(from, to, table, priority)
+}
+
 func SetInterfaceMac(name string, macaddr string) error {
 	iface, err := net.InterfaceByName(name)
 	if err != nil {
@@ -88,6 +171,45 @@ func SetInterfaceIp(name string, rawIp string) error {
 	return netlink.NetworkLinkAddIp(iface, ip, ipNet)
 }
 
+func AddNeighbor(name string, rawIp string, macaddr string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(rawIp)
+	if ip == nil {
+		return fmt.Errorf("invalid neighbor ip %s", rawIp)
+	}
+	hwaddr, err := net.ParseMAC(macaddr)
+	if err != nil {
+		return err
+	}
+	return netlink.NetworkAddNeighbor(iface, ip, hwaddr)
+}
+
+// FlushInterfaceAddresses removes all IPv4 and IPv6 addresses from the interface
+// except for IPv6 link-local addresses, which the kernel manages itself
+func FlushInterfaceAddresses(name string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast()) {
+			continue
+		}
+		if err := netlink.NetworkLinkDelIp(iface, ipNet.IP, ipNet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func SetMtu(name string, mtu int) error {
 	iface, err := net.InterfaceByName(name)
 	if err != nil {
@@ -96,6 +218,52 @@ func SetMtu(name string, mtu int) error {
 	return netlink.NetworkSetMTU(iface, mtu)
 }
 
+// SetInterfaceVRF enslaves the interface to the vrf device using netlink so that
+// it works for any kind of master device
+func SetInterfaceVRF(name, vrf string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	vrfIface, err := net.InterfaceByName(vrf)
+	if err != nil {
+		return err
+	}
+	return netlink.NetworkSetMaster(iface, vrfIface)
+}
+
+func SetTxQueueLen(name string, txQueueLen int) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.NetworkSetTxQueueLen(iface, txQueueLen)
+}
+
+func SetOffload(name, feature string, enabled bool) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.NetworkSetOffload(iface, feature, enabled)
+}
+
+func GetOffload(name, feature string) (bool, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return false, err
+	}
+	return netlink.NetworkGetOffload(iface, feature)
+}
+
+func SetInterfacePromiscuous(name string, enabled bool) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.NetworkSetPromiscMode(iface, enabled)
+}
+
 func SetHairpinMode(name string, enabled bool) error {
 	iface, err := net.InterfaceByName(name)
 	if err != nil {
@@ -103,3 +271,68 @@ func SetHairpinMode(name string, enabled bool) error {
 	}
 	return netlink.SetHairpinMode(iface, enabled)
 }
+
+// WaitForInterfaceUp polls the interface until it is up and has a carrier,
+// meaning it can pass traffic, or the timeout expires.  The state is read with
+// netlink because /sys still shows the host's interfaces while the container's
+// network is initialized.
+func WaitForInterfaceUp(name string, timeout time.Duration) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		up, err := netlink.NetworkLinkIsUp(iface)
+		if err != nil {
+			return err
+		}
+		if up {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s to be up", timeout, name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func SetIPv6Disabled(name string, disabled bool) error {
+	value := "0"
+	if disabled {
+		value = "1"
+	}
+	return setInterfaceSysctl("ipv6", name, "disable_ipv6", value)
+}
+
+// SetBridgeSTP enables or disables the spanning tree protocol on the bridge
+func SetBridgeSTP(name string, enabled bool) error {
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	return ioutil.WriteFile(filepath.Join("/sys/class/net", name, "bridge/stp_state"), []byte(value), 0644)
+}
+
+// SetAcceptRA sets how the interface accepts IPv6 router advertisements
+func SetAcceptRA(name string, acceptRA int) error {
+	return setInterfaceSysctl("ipv6", name, "accept_ra", strconv.Itoa(acceptRA))
+}
+
+// SetArp sets how the interface replies to and announces its addresses in arp
+func SetArp(name string, arpIgnore, arpAnnounce int) error {
+	if err := setInterfaceSysctl("ipv4", name, "arp_ignore", strconv.Itoa(arpIgnore)); err != nil {
+		return err
+	}
+	return setInterfaceSysctl("ipv4", name, "arp_announce", strconv.Itoa(arpAnnounce))
+}
+
+// setInterfaceSysctl writes value to the per interface sysctl key of the given
+// protocol family in the current network namespace
+func setInterfaceSysctl(family, name, key, value string) error {
+	return ioutil.WriteFile(interfaceSysctlPath(family, name, key), []byte(value), 0644)
+}
+
+func interfaceSysctlPath(family, name, key string) string {
+	return filepath.Join("/proc/sys/net", family, "conf", name, key)
+}
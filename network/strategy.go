@@ -4,16 +4,28 @@ package network
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 )
 
 var (
-	ErrNotValidStrategyType = errors.New("not a valid network strategy type")
+	ErrNotValidStrategyType         = errors.New("not a valid network strategy type")
+	ErrStrategyAlreadyRegistered    = errors.New("network strategy type is already registered")
+	ErrStrategyTypeNotSpecified     = errors.New("network strategy type is not specified")
+	ErrStrategyImplementationNotSet = errors.New("network strategy implementation is nil")
 )
 
-var strategies = map[string]NetworkStrategy{
-	"veth":     &Veth{},
-	"loopback": &Loopback{},
-	"netns":    &NetNS{},
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]NetworkStrategy{}
+)
+
+func init() {
+	RegisterStrategy("veth", &Veth{})
+	RegisterStrategy("loopback", &Loopback{})
+	RegisterStrategy("netns", &NetNS{})
+	RegisterStrategy("macvlan", &Macvlan{})
+	RegisterStrategy("ipvlan", &Ipvlan{})
 }
 
 // NetworkStrategy represents a specific network configuration for
@@ -23,13 +35,101 @@ type NetworkStrategy interface {
 	Initialize(*Network, *NetworkState) error
 }
 
+// NetworkDeleter is implemented by the network strategies that can remove
+// what Create set up on the host
+type NetworkDeleter interface {
+	Delete(*Network, *NetworkState) error
+}
+
+// RegisterStrategy makes a network strategy available under the provided
+// type so that it can be used by a Network's Type.  If a strategy is already
+// registered for the type an ErrStrategyAlreadyRegistered is returned.
+func RegisterStrategy(tpe string, s NetworkStrategy) error {
+	if tpe == "" {
+		return ErrStrategyTypeNotSpecified
+	}
+	if s == nil {
+		return ErrStrategyImplementationNotSet
+	}
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, exists := strategies[tpe]; exists {
+		return ErrStrategyAlreadyRegistered
+	}
+	strategies[tpe] = s
+	return nil
+}
+
 // GetStrategy returns the specific network strategy for the
 // provided type.  If no strategy is registered for the type an
 // ErrNotValidStrategyType is returned.
 func GetStrategy(tpe string) (NetworkStrategy, error) {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
 	s, exists := strategies[tpe]
 	if !exists {
 		return nil, ErrNotValidStrategyType
 	}
 	return s, nil
 }
+
+// CreateAll creates every network with its strategy, recording each one in
+// the network state at the same position.  If a network fails to be created
+// the networks that were already created are deleted again, using Delete when
+// their strategy is a NetworkDeleter and removing the interfaces that were moved
+// into the container's namespace.  A *RollbackError is returned if that fails.
+//
+// CreateAll is for callers that keep a network state per network and pass each
+// one to Initialize themselves.  libcontainer's own InitializeNetworking still
+// records every network in a single NetworkState, which only holds one interface.
+func CreateAll(networks []*Network, nspid int, states []*NetworkState) error {
+	if len(networks) != len(states) {
+		return fmt.Errorf("%d networks do not match %d network states", len(networks), len(states))
+	}
+	for i, state := range states {
+		if state == nil {
+			return fmt.Errorf("network state %d is nil", i)
+		}
+	}
+	var (
+		selected = make([]NetworkStrategy, len(networks))
+		names    = make(map[string]bool)
+	)
+	for i, n := range networks {
+		strategy, err := GetStrategy(n.Type)
+		if err != nil {
+			return err
+		}
+		selected[i] = strategy
+
+		// loopback and netns do not add an interface to the container
+		if n.Type == "loopback" || n.Type == "netns" {
+			continue
+		}
+		name := interfaceName(n)
+		if names[name] {
+			return fmt.Errorf("interface %s is used by more than one network", name)
+		}
+		names[name] = true
+	}
+	for i, n := range networks {
+		if err := selected[i].Create(n, nspid, states[i]); err != nil {
+			var rollback []error
+			for j := i; j >= 0; j-- {
+				if d, ok := selected[j].(NetworkDeleter); ok {
+					if err := d.Delete(networks[j], states[j]); err != nil {
+						rollback = append(rollback, err)
+					}
+				}
+				if err := deleteMovedInterface(networks[j], nspid, states[j]); err != nil {
+					rollback = append(rollback, err)
+				}
+			}
+			if len(rollback) > 0 {
+				return &RollbackError{Err: err, Rollback: rollback}
+			}
+			return err
+		}
+	}
+	return nil
+}
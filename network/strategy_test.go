@@ -0,0 +1,151 @@
+// +build linux
+
+package network
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+type fakeStrategy struct {
+}
+
+func (f *fakeStrategy) Create(n *Network, nspid int, networkState *NetworkState) error {
+	return nil
+}
+
+func (f *fakeStrategy) Initialize(config *Network, networkState *NetworkState) error {
+	return nil
+}
+
+// unregisterStrategy removes the strategy registered for the type so that
+// tests leave the registry as they found it
+func unregisterStrategy(tpe string) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	delete(strategies, tpe)
+}
+
+func TestBuiltinStrategies(t *testing.T) {
+	for _, tpe := range []string{"veth", "loopback", "netns", "macvlan", "ipvlan"} {
+		if _, err := GetStrategy(tpe); err != nil {
+			t.Fatalf("expected strategy %s to be registered but received %q", tpe, err)
+		}
+	}
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	fake := &fakeStrategy{}
+	if err := RegisterStrategy("fake", fake); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterStrategy("fake")
+
+	s, err := GetStrategy("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != fake {
+		t.Fatal("expected the registered strategy to be returned")
+	}
+
+	if err := RegisterStrategy("fake", &fakeStrategy{}); err != ErrStrategyAlreadyRegistered {
+		t.Fatalf("expected error to be ErrStrategyAlreadyRegistered but received %q", err)
+	}
+
+	if err := RegisterStrategy("", fake); err != ErrStrategyTypeNotSpecified {
+		t.Fatalf("expected error to be ErrStrategyTypeNotSpecified but received %q", err)
+	}
+}
+
+func TestGetUnknownStrategy(t *testing.T) {
+	if _, err := GetStrategy("unknown"); err != ErrNotValidStrategyType {
+		t.Fatalf("expected error to be ErrNotValidStrategyType but received %q", err)
+	}
+}
+
+func TestCreateAllValidation(t *testing.T) {
+	if err := CreateAll([]*Network{{Type: "loopback"}}, 1, nil); err == nil {
+		t.Fatal("expected error to not be nil with missing network states")
+	}
+
+	networks := []*Network{
+		{Type: "loopback"},
+		{Type: "veth", Bridge: "br0", VethPrefix: "veth"},
+		{Type: "veth", Bridge: "br1", VethPrefix: "veth"},
+	}
+	states := []*NetworkState{{}, {}, {}}
+	if err := CreateAll(networks, 1, states); err == nil {
+		t.Fatal("expected error to not be nil with two networks using eth0")
+	}
+
+	if err := CreateAll([]*Network{{Type: "loopback"}}, 1, []*NetworkState{nil}); err == nil {
+		t.Fatal("expected error to not be nil with a nil network state")
+	}
+}
+
+func TestCreateAllRollback(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	networks := []*Network{
+		{Type: "veth", Bridge: "testbr6", CreateBridge: true, VethPrefix: "veth", InterfaceName: "mgmt0"},
+		{Type: "veth", Bridge: "brmissing0", VethPrefix: "veth", InterfaceName: "data0"},
+	}
+	defer DeleteBridge("testbr6")
+
+	states := []*NetworkState{{}, {}}
+	if err := CreateAll(networks, os.Getpid(), states); !errors.Is(err, ErrBridgeNotFound) {
+		t.Fatalf("expected error to be %q but received %v", ErrBridgeNotFound, err)
+	}
+
+	if states[0].VethHost == "" {
+		t.Fatal("expected the first network to be created")
+	}
+	if _, err := net.InterfaceByName(states[0].VethHost); err == nil {
+		t.Fatalf("expected %s to be deleted after the second network failed", states[0].VethHost)
+	}
+}
+
+func TestCreateAllRollbackInNamespace(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	if err := exec.Command("ip", "netns", "add", "tstns3").Run(); err != nil {
+		t.Skipf("unable to create a named network namespace: %s", err)
+	}
+	defer exec.Command("ip", "netns", "delete", "tstns3").Run()
+
+	parent, _, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(parent)
+
+	// the macvlan is moved into the namespace before the second network fails
+	networks := []*Network{
+		{Type: "macvlan", Parent: parent, InterfaceName: "mgmt0", NamespacePath: "/var/run/netns/tstns3"},
+		{Type: "veth", Bridge: "brmissing0", VethPrefix: "veth", InterfaceName: "data0", NamespacePath: "/var/run/netns/tstns3"},
+	}
+	states := []*NetworkState{{}, {}}
+	if err := CreateAll(networks, 1<<30, states); !errors.Is(err, ErrBridgeNotFound) {
+		t.Fatalf("expected error to be %q but received %v", ErrBridgeNotFound, err)
+	}
+	if states[0].VethChild == "" {
+		t.Fatal("expected the first network to be created")
+	}
+
+	out, err := exec.Command("ip", "netns", "exec", "tstns3", "ip", "-o", "link", "show").CombinedOutput()
+	if err != nil {
+		t.Fatalf("unable to list the links of the namespace: %s: %s", err, out)
+	}
+	if links := strings.Split(strings.TrimSpace(string(out)), "\n"); len(links) != 1 {
+		t.Fatalf("expected only the loopback interface to be left in the namespace but received %q", out)
+	}
+}
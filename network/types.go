@@ -1,5 +1,8 @@
 package network
 
+// InheritBridgeMtu can be set as a Network's Mtu to use the mtu of the bridge
+const InheritBridgeMtu = -1
+
 // Network defines configuration for a container's networking stack
 //
 // The network configuration can be omited from a container causing the
@@ -11,38 +14,200 @@ type Network struct {
 	// Path to network namespace
 	NsPath string `json:"ns_path,omitempty"`
 
+	// NamespacePath is the path of a network namespace, such as /var/run/netns/<name>,
+	// that the veth, macvlan and ipvlan strategies move the container's interface into
+	// instead of the namespace of the container's pid
+	NamespacePath string `json:"namespace_path,omitempty"`
+
+	// NamespaceInode is the inode of the network namespace that the veth, macvlan and
+	// ipvlan strategies move the container's interface into when NamespacePath is not set
+	NamespaceInode uint64 `json:"namespace_inode,omitempty"`
+
 	// The bridge to use.
 	Bridge string `json:"bridge,omitempty"`
 
+	// CreateBridge creates the bridge if it does not already exist on the host
+	CreateBridge bool `json:"create_bridge,omitempty"`
+
+	// EnableSTP enables the spanning tree protocol on the bridge.  It can only be set
+	// together with CreateBridge and applies when the bridge is created
+	EnableSTP bool `json:"enable_stp,omitempty"`
+
+	// Parent is the host interface that macvlan and ipvlan interfaces are created on
+	Parent string `json:"parent,omitempty"`
+
+	// MacvlanMode sets the mode of macvlan interfaces: bridge, private, vepa or passthru.
+	// bridge is used when empty
+	MacvlanMode string `json:"macvlan_mode,omitempty"`
+
+	// IpvlanMode sets the mode of ipvlan interfaces: l2 or l3.  l2 is used when empty
+	IpvlanMode string `json:"ipvlan_mode,omitempty"`
+
 	// Prefix for the veth interfaces.
 	VethPrefix string `json:"veth_prefix,omitempty"`
 
+	// VethSuffixLength sets the length of the random suffix appended to VethPrefix.
+	// When it is 0 a default is used, shortened to fit long prefixes.
+	VethSuffixLength int `json:"veth_suffix_length,omitempty"`
+
+	// InterfaceName sets the name of the interface inside the container, eth0 is used when empty
+	InterfaceName string `json:"interface_name,omitempty"`
+
 	// MacAddress contains the MAC address to set on the network interface
 	MacAddress string `json:"mac_address,omitempty"`
 
+	// DeriveMacFromID sets a mac address derived from ContainerID on the network
+	// interface when MacAddress is empty, so that it is the same every time
+	DeriveMacFromID bool `json:"derive_mac_from_id,omitempty"`
+
+	// ContainerID is the id of the container that DeriveMacFromID derives the
+	// mac address from
+	ContainerID string `json:"container_id,omitempty"`
+
 	// Address contains the IPv4 and mask to set on the network interface
+	// If it and Addresses are empty the interface is configured with IPv6 only
 	Address string `json:"address,omitempty"`
 
+	// Addresses contains additional IPv4 addresses and masks to set on the network
+	// interface.  They are applied in order after Address
+	Addresses []string `json:"addresses,omitempty"`
+
 	// IPv6Address contains the IPv6 and mask to set on the network interface
 	IPv6Address string `json:"ipv6_address,omitempty"`
 
-	// Gateway sets the gateway address that is used as the default for the interface
+	// IPv6Addresses contains additional IPv6 addresses and masks to set on the network
+	// interface.  They are applied in order after IPv6Address
+	IPv6Addresses []string `json:"ipv6_addresses,omitempty"`
+
+	// KeepAddresses keeps any address that the interface already has when it is
+	// initialized.  By default they are flushed before the configured addresses are set
+	KeepAddresses bool `json:"keep_addresses,omitempty"`
+
+	// DisableIPv6 disables IPv6 on the interface.  It can not be used together with
+	// IPv6Address, IPv6Addresses or IPv6Gateway
+	DisableIPv6 bool `json:"disable_ipv6,omitempty"`
+
+	// AcceptRA sets the accept_ra sysctl of the interface so that it can autoconfigure
+	// its IPv6 addresses from router advertisements: 1 accepts them unless forwarding
+	// is enabled and 2 always accepts them.  0 keeps the kernel's default.
+	// IPv6Address can be left empty when router advertisements are accepted
+	AcceptRA int `json:"accept_ra,omitempty"`
+
+	// ArpIgnore sets the arp_ignore sysctl of the interface: 0 to 3 or 8
+	ArpIgnore int `json:"arp_ignore,omitempty"`
+
+	// ArpAnnounce sets the arp_announce sysctl of the interface: 0 to 2
+	ArpAnnounce int `json:"arp_announce,omitempty"`
+
+	// Gateway sets the gateway address that is used as the default for the interface.
+	// It must be within the subnet of one of the addresses unless GatewayOnLink is set
 	Gateway string `json:"gateway,omitempty"`
 
 	// IPv6Gateway sets the ipv6 gateway address that is used as the default for the interface
 	IPv6Gateway string `json:"ipv6_gateway,omitempty"`
 
+	// GatewayOnLink allows Gateway and IPv6Gateway to be outside of the subnets of the
+	// interface's addresses by adding the default routes as on link
+	GatewayOnLink bool `json:"gateway_on_link,omitempty"`
+
+	// VRF is the name of a vrf device inside the container's namespace that the interface
+	// is enslaved to before its addresses are set.  Routes for the vrf should set the vrf's Table
+	VRF string `json:"vrf,omitempty"`
+
+	// NoDefaultRoute removes any default route through the interface once the routes
+	// have been set up.  It can not be used together with Gateway, IPv6Gateway, AcceptRA
+	// or a default route of the main table in Routes
+	NoDefaultRoute bool `json:"no_default_route,omitempty"`
+
+	// Routes contains additional static routes to install on the interface after
+	// the default gateways have been set
+	Routes []Route `json:"routes,omitempty"`
+
+	// Rules contains routing policy rules to install once the routes have been set,
+	// routes for their tables are set up through Routes
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Neighbors contains permanent ARP or NDP entries to add to the interface
+	Neighbors []Neighbor `json:"neighbors,omitempty"`
+
 	// Mtu sets the mtu value for the interface and will be mirrored on both the host and
 	// container's interfaces if a pair is created, specifically in the case of type veth
+	// If it is 0 the interfaces keep their default mtu and if it is InheritBridgeMtu
+	// the bridge's mtu is used.
 	// Note: This does not apply to loopback interfaces.
 	Mtu int `json:"mtu,omitempty"`
 
+	// IgnoreBridgeMtu allows the veth interfaces to use an mtu larger than the bridge's,
+	// otherwise that is rejected because the bridge would drop the larger frames
+	IgnoreBridgeMtu bool `json:"ignore_bridge_mtu,omitempty"`
+
+	// Promiscuous enables promiscuous mode on the container's interface so that it
+	// receives all traffic seen on the bridge
+	Promiscuous bool `json:"promiscuous,omitempty"`
+
+	// WaitForUp blocks the initialization of the interface until its operational
+	// state is up
+	WaitForUp bool `json:"wait_for_up,omitempty"`
+
+	// DNS contains the nameservers to use for the interface.  They are not written to
+	// the container's resolv.conf but are recorded in the NetworkState for the caller
+	DNS []string `json:"dns,omitempty"`
+
+	// DNSSearch contains the search domains to use for the interface.  Like DNS, they
+	// are only recorded in the NetworkState
+	DNSSearch []string `json:"dns_search,omitempty"`
+
+	// Offloads enables or disables offload features of the container's interface.
+	// Valid features are rx, tx, sg, tso, gso and gro
+	Offloads map[string]bool `json:"offloads,omitempty"`
+
 	// TxQueueLen sets the tx_queuelen value for the interface and will be mirrored on both the host and
-	// container's interfaces if a pair is created, specifically in the case of type veth
+	// container's interfaces if a pair is created, specifically in the case of type veth.
+	// It is applied to the container's interface when it is initialized and must not be negative.
 	// Note: This does not apply to loopback interfaces.
 	TxQueueLen int `json:"txqueuelen,omitempty"`
 }
 
+// Route describes a static route to install on a container's interface
+type Route struct {
+	// Destination sets the destination and mask, should be a CIDR.  Accepts IPv4 and IPv6
+	Destination string `json:"destination,omitempty"`
+
+	// Gateway sets the next-hop for the destination.  Accepts IPv4 and IPv6
+	Gateway string `json:"gateway,omitempty"`
+
+	// Metric sets the priority of the route, the kernel default is used when it is 0
+	Metric int `json:"metric,omitempty"`
+
+	// Table sets the routing table for the route, the main table is used when it is 0
+	Table int `json:"table,omitempty"`
+}
+
+// Rule describes a routing policy rule that selects the routing table used for
+// traffic from and/or to the given networks, for example: from 10.1.0.5 table 100
+type Rule struct {
+	// From selects traffic by its source, should be an IP or a CIDR.  Accepts IPv4 and IPv6
+	From string `json:"from,omitempty"`
+
+	// To selects traffic by its destination, should be an IP or a CIDR.  Accepts IPv4 and IPv6
+	To string `json:"to,omitempty"`
+
+	// Table is the routing table used for the selected traffic
+	Table int `json:"table,omitempty"`
+
+	// Priority orders the rule among the others, the kernel picks one when it is 0
+	Priority int `json:"priority,omitempty"`
+}
+
+// Neighbor describes a permanent ARP (IPv4) or NDP (IPv6) entry on a container's interface
+type Neighbor struct {
+	// IP is the address of the neighbor.  Accepts IPv4 and IPv6
+	IP string `json:"ip,omitempty"`
+
+	// MacAddress is the link layer address of the neighbor
+	MacAddress string `json:"mac_address,omitempty"`
+}
+
 // Struct describing the network specific runtime state that will be maintained by libcontainer for all running containers
 // Do not depend on it outside of libcontainer.
 type NetworkState struct {
@@ -50,6 +215,16 @@ type NetworkState struct {
 	VethHost string `json:"veth_host,omitempty"`
 	// The name of the veth interface created inside the container for the child.
 	VethChild string `json:"veth_child,omitempty"`
+	// The name the child veth interface is given once it is inside the container.
+	Interface string `json:"interface,omitempty"`
+	// The index of the child interface, which it keeps when it is moved into the container.
+	VethChildIndex int `json:"veth_child_index,omitempty"`
 	// Net namespace path.
 	NsPath string `json:"ns_path,omitempty"`
+	// The nameservers of the container's networks, in the order they were configured.
+	DNS []string `json:"dns,omitempty"`
+	// The search domains of the container's networks, in the order they were configured.
+	DNSSearch []string `json:"dns_search,omitempty"`
+	// The routing policy rules applied for the container's interface, replaced by Reconfigure.
+	Rules []Rule `json:"rules,omitempty"`
 }
@@ -0,0 +1,344 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/libcontainer/netlink"
+)
+
+const (
+	minMtu = 68
+	maxMtu = 65536
+
+	// maxInterfaceNameLength is IFNAMSIZ without the trailing NUL
+	maxInterfaceNameLength = 15
+
+	// mainRoutingTable is RT_TABLE_MAIN, the table routes are added to by default
+	mainRoutingTable = 254
+)
+
+var vethPrefixPattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+var macvlanModes = map[string]bool{
+	"bridge":   true,
+	"private":  true,
+	"vepa":     true,
+	"passthru": true,
+}
+
+var ipvlanModes = map[string]bool{
+	"l2": true,
+	"l3": true,
+}
+
+// validateMtu ensures that the mtu is within the range supported by the kernel.
+// A zero mtu is valid and keeps the interface's default, as is InheritBridgeMtu.
+func validateMtu(mtu int) error {
+	if mtu == 0 || mtu == InheritBridgeMtu {
+		return nil
+	}
+	if mtu < minMtu || mtu > maxMtu {
+		return fmt.Errorf("mtu %d is not between %d and %d", mtu, minMtu, maxMtu)
+	}
+	return nil
+}
+
+// validateTxQueueLen ensures that the tx queue length is not negative.
+// A zero length keeps the interface's default.
+func validateTxQueueLen(txQueueLen int) error {
+	if txQueueLen < 0 {
+		return fmt.Errorf("txqueuelen %d can not be negative", txQueueLen)
+	}
+	return nil
+}
+
+// validateAcceptRA ensures that acceptRA is one of the values of the accept_ra sysctl
+func validateAcceptRA(acceptRA int) error {
+	if acceptRA < 0 || acceptRA > 2 {
+		return fmt.Errorf("accept_ra %d is not between 0 and 2", acceptRA)
+	}
+	return nil
+}
+
+// validateVethPrefix ensures that prefix is made of lower case letters and digits,
+// starts with a letter and leaves room for the random suffix of the interface name
+func validateVethPrefix(prefix string) error {
+	if !vethPrefixPattern.MatchString(prefix) {
+		return fmt.Errorf("veth prefix %q must start with a lower case letter followed by lower case letters or digits", prefix)
+	}
+	if len(prefix) >= maxInterfaceNameLength {
+		return fmt.Errorf("veth prefix %q leaves no room for a suffix within %d characters", prefix, maxInterfaceNameLength)
+	}
+	return nil
+}
+
+// validateArp ensures that arpIgnore and arpAnnounce are values documented for
+// the arp_ignore and arp_announce sysctls
+func validateArp(arpIgnore, arpAnnounce int) error {
+	if (arpIgnore < 0 || arpIgnore > 3) && arpIgnore != 8 {
+		return fmt.Errorf("arp_ignore %d is not between 0 and 3 or 8", arpIgnore)
+	}
+	if arpAnnounce < 0 || arpAnnounce > 2 {
+		return fmt.Errorf("arp_announce %d is not between 0 and 2", arpAnnounce)
+	}
+	return nil
+}
+
+// validateOffloads ensures that every feature of offloads is one that can be toggled
+func validateOffloads(offloads map[string]bool) error {
+	known := make(map[string]bool)
+	for _, feature := range netlink.NetworkOffloadFeatures() {
+		known[feature] = true
+	}
+	var unknown []string
+	for _, feature := range offloadFeatures(offloads) {
+		if !known[feature] {
+			unknown = append(unknown, feature)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("offload features %s are not one of %s", strings.Join(unknown, ", "), strings.Join(netlink.NetworkOffloadFeatures(), ", "))
+	}
+	return nil
+}
+
+// offloadFeatures returns the features of offloads sorted so that
+// they are always applied in the same order
+func offloadFeatures(offloads map[string]bool) []string {
+	features := make([]string, 0, len(offloads))
+	for feature := range offloads {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// validateInterfaceName ensures that name can be used as a network interface name
+func validateInterfaceName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid interface name %q", name)
+	}
+	if len(name) > maxInterfaceNameLength {
+		return fmt.Errorf("interface name %q is longer than %d characters", name, maxInterfaceNameLength)
+	}
+	if strings.ContainsAny(name, "/: \t\n") {
+		return fmt.Errorf("interface name %q contains an invalid character", name)
+	}
+	return nil
+}
+
+// Validate checks every setting of the network that can be checked before any
+// interface is created and returns a single error listing all of the problems
+func (n *Network) Validate() error {
+	var problems []error
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	switch n.Type {
+	case "veth":
+		if n.Bridge == "" {
+			check(ErrBridgeNotSpecified)
+		}
+		if n.VethPrefix == "" {
+			check(ErrVethPrefixNotSpecified)
+		}
+	case "macvlan", "ipvlan":
+		if n.Parent == "" {
+			check(ErrParentNotSpecified)
+		}
+	}
+	if n.MacvlanMode != "" && !macvlanModes[n.MacvlanMode] {
+		check(fmt.Errorf("macvlan mode %q is not valid", n.MacvlanMode))
+	}
+	if n.IpvlanMode != "" && !ipvlanModes[n.IpvlanMode] {
+		check(fmt.Errorf("ipvlan mode %q is not valid", n.IpvlanMode))
+	}
+	if n.VethPrefix != "" {
+		check(validateVethPrefix(n.VethPrefix))
+	}
+	if n.EnableSTP && !n.CreateBridge {
+		check(fmt.Errorf("stp can only be enabled on bridge %s when it is created", n.Bridge))
+	}
+	if n.DeriveMacFromID && n.MacAddress == "" && n.ContainerID == "" {
+		check(fmt.Errorf("container id is not specified to derive the mac address from"))
+	}
+	problems = append(problems, interfaceProblems(n)...)
+
+	// the loopback strategy does not apply any address, the sample
+	// configs set its gateway to localhost
+	if n.Type != "loopback" {
+		problems = append(problems, addressProblems(n)...)
+	}
+	return joinProblems(problems)
+}
+
+// interfaceProblems returns the problems with the settings that are applied to
+// the interface inside the container, other than its addresses and routes
+func interfaceProblems(n *Network) []error {
+	var problems []error
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if n.InterfaceName != "" {
+		check(validateInterfaceName(n.InterfaceName))
+	}
+	check(validateMtu(n.Mtu))
+	check(validateTxQueueLen(n.TxQueueLen))
+	check(validateAcceptRA(n.AcceptRA))
+	check(validateArp(n.ArpIgnore, n.ArpAnnounce))
+	check(validateOffloads(n.Offloads))
+	if n.NoDefaultRoute && n.AcceptRA != 0 {
+		// a router advertisement would install a default route later on
+		check(fmt.Errorf("router advertisements can not be accepted when no default route is requested"))
+	}
+	if n.DisableIPv6 && n.AcceptRA != 0 {
+		check(fmt.Errorf("ipv6 can not be disabled when router advertisements are accepted"))
+	}
+	for _, neighbor := range n.Neighbors {
+		if net.ParseIP(neighbor.IP) == nil {
+			check(fmt.Errorf("neighbor ip %q is not a valid ip", neighbor.IP))
+		}
+		if _, err := net.ParseMAC(neighbor.MacAddress); err != nil {
+			check(fmt.Errorf("neighbor mac address %q is not valid", neighbor.MacAddress))
+		}
+	}
+	return problems
+}
+
+// addressProblems returns the problems with the addresses, gateways, routes and
+// rules of n, which are checked again whenever they are applied inside the container
+func addressProblems(n *Network) []error {
+	var problems []error
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	ipv4Nets, err := parseAddresses(n.Address, n.Addresses)
+	check(err)
+	ipv6Nets, err := parseAddresses(n.IPv6Address, n.IPv6Addresses)
+	check(err)
+	if n.DisableIPv6 && (len(ipv6Nets) > 0 || n.IPv6Gateway != "") {
+		check(fmt.Errorf("ipv6 can not be disabled when ipv6 addresses are configured"))
+	}
+	if n.Gateway != "" {
+		check(validateGateway(n.Gateway, ipv4Nets, n.GatewayOnLink))
+	}
+	if n.IPv6Gateway != "" {
+		check(validateGateway(n.IPv6Gateway, ipv6Nets, n.GatewayOnLink))
+	}
+	if n.NoDefaultRoute && (n.Gateway != "" || n.IPv6Gateway != "" || hasDefaultRoute(n.Routes)) {
+		check(fmt.Errorf("default route can not be configured when no default route is requested"))
+	}
+	for _, route := range n.Routes {
+		if _, _, err := net.ParseCIDR(route.Destination); err != nil {
+			check(fmt.Errorf("route destination %q is not a valid CIDR", route.Destination))
+		}
+	}
+	for _, rule := range n.Rules {
+		check(validateRule(rule))
+	}
+	return problems
+}
+
+// validateRule ensures that the rule selects traffic by valid IPs or CIDRs
+// and looks up a valid table
+func validateRule(rule Rule) error {
+	if rule.From == "" && rule.To == "" {
+		return fmt.Errorf("rule for table %d needs one of from or to", rule.Table)
+	}
+	for _, selector := range []string{rule.From, rule.To} {
+		if selector == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(selector); err != nil && net.ParseIP(selector) == nil {
+			return fmt.Errorf("rule selector %q is neither an ip nor a CIDR", selector)
+		}
+	}
+	if rule.Table <= 0 {
+		return fmt.Errorf("rule table %d is not valid", rule.Table)
+	}
+	return nil
+}
+
+// hasDefaultRoute returns true if one of the routes is a default route of the main table
+func hasDefaultRoute(routes []Route) bool {
+	for _, route := range routes {
+		_, dest, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			continue
+		}
+		if ones, _ := dest.Mask.Size(); ones == 0 && (route.Table == 0 || route.Table == mainRoutingTable) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinProblems returns a single error listing all of the problems or nil
+// if there are none
+func joinProblems(problems []error) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Error()
+	}
+	return fmt.Errorf("invalid network: %s", strings.Join(messages, "; "))
+}
+
+// parseAddresses parses the primary and additional addresses as CIDRs,
+// skipping an empty primary address
+func parseAddresses(primary string, additional []string) ([]*net.IPNet, error) {
+	var (
+		nets    []*net.IPNet
+		invalid []string
+	)
+	for _, address := range append([]string{primary}, additional...) {
+		if address == "" {
+			continue
+		}
+		ip, ipNet, err := net.ParseCIDR(address)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q", address))
+			continue
+		}
+		ipNet.IP = ip
+		nets = append(nets, ipNet)
+	}
+	if len(invalid) > 0 {
+		return nets, fmt.Errorf("addresses %s are not valid CIDRs", strings.Join(invalid, ", "))
+	}
+	return nets, nil
+}
+
+// validateGateway ensures that gateway is an ip within the subnet of one of the
+// addresses unless it is explicitly on link.  Link local ipv6 gateways are always
+// on link and a gateway without any address is not checked against a subnet.
+func validateGateway(gateway string, nets []*net.IPNet, onLink bool) error {
+	ip := net.ParseIP(gateway)
+	if ip == nil {
+		return fmt.Errorf("gateway %q is not a valid ip", gateway)
+	}
+	if onLink || len(nets) == 0 || ip.IsLinkLocalUnicast() {
+		return nil
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("gateway %s is not within the subnet of any address, set gateway_on_link if it is reachable on the link", gateway)
+}
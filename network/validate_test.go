@@ -0,0 +1,168 @@
+package network
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateMtu(t *testing.T) {
+	for _, mtu := range []int{0, InheritBridgeMtu, 68, 1500, 9000, 65536} {
+		if err := validateMtu(mtu); err != nil {
+			t.Fatalf("expected mtu %d to be valid but received %q", mtu, err)
+		}
+	}
+
+	for _, mtu := range []int{-2, 1, 67, 65537} {
+		if err := validateMtu(mtu); err == nil {
+			t.Fatalf("expected mtu %d to be invalid", mtu)
+		}
+	}
+}
+
+func TestValidateTxQueueLen(t *testing.T) {
+	for _, txQueueLen := range []int{0, 1, 1000, 10000} {
+		if err := validateTxQueueLen(txQueueLen); err != nil {
+			t.Fatalf("expected txqueuelen %d to be valid but received %q", txQueueLen, err)
+		}
+	}
+
+	if err := validateTxQueueLen(-1); err == nil {
+		t.Fatal("expected txqueuelen -1 to be invalid")
+	}
+}
+
+func TestValidateAcceptRA(t *testing.T) {
+	for _, acceptRA := range []int{0, 1, 2} {
+		if err := validateAcceptRA(acceptRA); err != nil {
+			t.Fatalf("expected accept_ra %d to be valid but received %q", acceptRA, err)
+		}
+	}
+
+	for _, acceptRA := range []int{-1, 3} {
+		if err := validateAcceptRA(acceptRA); err == nil {
+			t.Fatalf("expected accept_ra %d to be invalid", acceptRA)
+		}
+	}
+}
+
+func TestValidateVethPrefix(t *testing.T) {
+	for _, prefix := range []string{"veth", "v", "mv", "ovs0", "abcdefghijklmn"} {
+		if err := validateVethPrefix(prefix); err != nil {
+			t.Fatalf("expected veth prefix %q to be valid but received %q", prefix, err)
+		}
+	}
+
+	for _, prefix := range []string{"", " ", "0veth", "Veth", "veth-", "veth_0", "veth 0", "abcdefghijklmno"} {
+		if err := validateVethPrefix(prefix); err == nil {
+			t.Fatalf("expected veth prefix %q to be invalid", prefix)
+		}
+	}
+}
+
+func TestValidateArp(t *testing.T) {
+	for _, values := range [][2]int{{0, 0}, {1, 2}, {3, 1}, {8, 0}} {
+		if err := validateArp(values[0], values[1]); err != nil {
+			t.Fatalf("expected arp_ignore %d and arp_announce %d to be valid but received %q", values[0], values[1], err)
+		}
+	}
+
+	for _, values := range [][2]int{{-1, 0}, {4, 0}, {9, 0}, {0, -1}, {0, 3}} {
+		if err := validateArp(values[0], values[1]); err == nil {
+			t.Fatalf("expected arp_ignore %d and arp_announce %d to be invalid", values[0], values[1])
+		}
+	}
+}
+
+func TestValidateInterfaceName(t *testing.T) {
+	for _, name := range []string{"eth0", "net1", "a", "abcdefghijklmno"} {
+		if err := validateInterfaceName(name); err != nil {
+			t.Fatalf("expected interface name %q to be valid but received %q", name, err)
+		}
+	}
+
+	for _, name := range []string{"", ".", "..", "abcdefghijklmnop", "eth/0", "eth:0", "eth 0"} {
+		if err := validateInterfaceName(name); err == nil {
+			t.Fatalf("expected interface name %q to be invalid", name)
+		}
+	}
+}
+
+func TestNetworkValidate(t *testing.T) {
+	valid := []*Network{
+		{Type: "loopback", Address: "127.0.0.1/0", Gateway: "localhost", Mtu: 1500},
+		{Type: "veth", Bridge: "docker0", VethPrefix: "veth", Address: "172.17.0.101/16", Gateway: "172.17.42.1", Mtu: 1500},
+		{Type: "veth", Bridge: "br0", VethPrefix: "veth", IPv6Address: "2001:db8::2/64", IPv6Gateway: "fe80::1"},
+		{Type: "macvlan", Parent: "eth0"},
+		{Type: "macvlan", Parent: "eth0", MacvlanMode: "passthru"},
+		{Type: "ipvlan", Parent: "eth0", IpvlanMode: "l3"},
+		{Type: "veth", Bridge: "br0", VethPrefix: "veth", Address: "10.0.0.2/24", Gateway: "10.0.1.1", GatewayOnLink: true},
+	}
+	for _, n := range valid {
+		if err := n.Validate(); err != nil {
+			t.Fatalf("expected %#v to be valid but received %q", n, err)
+		}
+	}
+
+	for _, test := range []struct {
+		network  *Network
+		problems int
+	}{
+		{&Network{Type: "veth"}, 2},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth-"}, 1},
+		{&Network{Type: "macvlan", VethPrefix: "mv", Mtu: 10}, 2},
+		{&Network{Type: "macvlan", Parent: "eth0", MacvlanMode: "unknown"}, 1},
+		{&Network{Type: "ipvlan", Parent: "eth0", IpvlanMode: "l4"}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", Address: "10.0.0.2", Addresses: []string{"10.0.1.2/33"}}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", Address: "10.0.0.2/24", Gateway: "10.0.1.1"}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", Gateway: "gateway"}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", IPv6Address: "2001:db8::2/64", IPv6Gateway: "2001:db9::1", DisableIPv6: true}, 2},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", EnableSTP: true, AcceptRA: 3, TxQueueLen: -1}, 3},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", DeriveMacFromID: true}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", NoDefaultRoute: true, AcceptRA: 2}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", Address: "10.0.0.2/24", Gateway: "10.0.0.1", NoDefaultRoute: true, Routes: []Route{{Destination: "::/0"}}}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", DisableIPv6: true, AcceptRA: 1}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", Neighbors: []Neighbor{{IP: "10.0.0.300", MacAddress: "02:42:ac:11:00"}}}, 2},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", Rules: []Rule{{Table: 100}, {From: "10.0.0.0/33", Table: 100}, {To: "10.0.0.5"}}}, 3},
+		{&Network{Type: "loopback", Mtu: 10, Offloads: map[string]bool{"lro": true}}, 2},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", Offloads: map[string]bool{"tso": false, "lro": false, "ufo": true}}, 1},
+		{&Network{Type: "veth", Bridge: "br0", VethPrefix: "veth", InterfaceName: "eth/0", Routes: []Route{{Destination: "10.0.0.0"}}}, 2},
+	} {
+		err := test.network.Validate()
+		if err == nil {
+			t.Fatalf("expected %#v to be invalid", test.network)
+		}
+		if problems := strings.Count(err.Error(), ";") + 1; problems != test.problems {
+			t.Fatalf("expected %d problems for %#v but received %q", test.problems, test.network, err)
+		}
+	}
+}
+
+func TestValidateSampleConfigs(t *testing.T) {
+	paths, err := filepath.Glob("../sample_configs/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("expected sample configs to be found")
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config struct {
+			Networks []*Network `json:"networks"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatalf("unable to decode %s: %s", path, err)
+		}
+		for _, n := range config.Networks {
+			if err := n.Validate(); err != nil {
+				t.Fatalf("expected the %s network of %s to be valid but received %q", n.Type, path, err)
+			}
+		}
+	}
+}
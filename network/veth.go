@@ -4,8 +4,14 @@ package network
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/docker/libcontainer/netlink"
+	"github.com/docker/libcontainer/system"
 	"github.com/docker/libcontainer/utils"
 )
 
@@ -15,7 +21,16 @@ import (
 type Veth struct {
 }
 
-const defaultDevice = "eth0"
+const (
+	defaultDevice = "eth0"
+
+	// defaultVethSuffixLength is the length of the random part of veth names
+	defaultVethSuffixLength = 7
+
+	// waitForUpTimeout is how long Initialize waits for the interface to be up
+	// when the network has WaitForUp set
+	waitForUpTimeout = 5 * time.Second
+)
 
 func (v *Veth) Create(n *Network, nspid int, networkState *NetworkState) error {
 	var (
@@ -24,86 +39,536 @@ func (v *Veth) Create(n *Network, nspid int, networkState *NetworkState) error {
 		txQueueLen = n.TxQueueLen
 	)
 	if bridge == "" {
-		return fmt.Errorf("bridge is not specified")
+		return ErrBridgeNotSpecified
 	}
 	if prefix == "" {
-		return fmt.Errorf("veth prefix is not specified")
+		return ErrVethPrefixNotSpecified
 	}
-	name1, name2, err := createVethPair(prefix, txQueueLen)
+	if err := n.Validate(); err != nil {
+		return err
+	}
+	bridgeIface, err := net.InterfaceByName(bridge)
+	if err != nil {
+		if !n.CreateBridge {
+			return newError(ErrBridgeNotFound, "bridge %s", bridge)
+		}
+		created, err := createBridge(bridge)
+		if err != nil {
+			return err
+		}
+		if n.EnableSTP {
+			if err := SetBridgeSTP(bridge, true); err != nil {
+				err = fmt.Errorf("enable stp on bridge %s %s", bridge, err)
+				// a bridge that another container created at the same time is left in use
+				if created {
+					if derr := DeleteBridge(bridge); derr != nil {
+						err = fmt.Errorf("%s and delete bridge %s", err, derr)
+					}
+				}
+				return err
+			}
+		}
+		if bridgeIface, err = net.InterfaceByName(bridge); err != nil {
+			return err
+		}
+	}
+	mtu := n.Mtu
+	if mtu == InheritBridgeMtu {
+		mtu = bridgeIface.MTU
+	} else if mtu > bridgeIface.MTU && !n.IgnoreBridgeMtu {
+		return fmt.Errorf("mtu %d is larger than the mtu %d of bridge %s", mtu, bridgeIface.MTU, bridge)
+	}
+	name1, name2, err := createVethPair(prefix, n.VethSuffixLength, txQueueLen)
 	if err != nil {
 		return err
 	}
-	if err := SetInterfaceMaster(name1, bridge); err != nil {
+	// record the pair straight away so that it can be cleaned up even if
+	// one of the following steps fails
+	networkState.VethHost = name1
+	networkState.VethChild = name2
+	networkState.Interface = interfaceName(n)
+	networkState.Rules = n.Rules
+	recordDNS(n, networkState)
+
+	child, err := net.InterfaceByName(name2)
+	if err != nil {
 		return err
 	}
-	if err := SetMtu(name1, n.Mtu); err != nil {
+	networkState.VethChildIndex = child.Index
+	if err := SetInterfaceMaster(name1, bridge); err != nil {
 		return err
 	}
+	if mtu != 0 {
+		if err := SetMtu(name1, mtu); err != nil {
+			return err
+		}
+	}
+	// the container can not see the bridge so set the inherited mtu
+	// on the child before it is moved into the namespace
+	if n.Mtu == InheritBridgeMtu {
+		if err := SetMtu(name2, mtu); err != nil {
+			return err
+		}
+	}
 	if err := InterfaceUp(name1); err != nil {
 		return err
 	}
-	if err := SetInterfaceInNamespacePid(name2, nspid); err != nil {
+	if err := moveToNamespace(child.Index, name2, n, nspid); err != nil {
 		return err
 	}
-	networkState.VethHost = name1
-	networkState.VethChild = name2
-
 	return nil
 }
 
 func (v *Veth) Initialize(config *Network, networkState *NetworkState) error {
-	var vethChild = networkState.VethChild
+	return initializeInterface(config, networkState)
+}
+
+// initializeInterface configures the child interface that Create moved into the
+// container by renaming it and setting its addresses, mtu and routes.  It is shared
+// by the strategies that move a single interface into the container's namespace.
+func initializeInterface(config *Network, networkState *NetworkState) error {
+	var (
+		vethChild = networkState.VethChild
+		device    = interfaceName(config)
+	)
 	if vethChild == "" {
-		return fmt.Errorf("vethChild is not specified")
+		return ErrVethChildNotSpecified
+	}
+	// the network can be initialized without having been validated on the host
+	if err := joinProblems(append(interfaceProblems(config), addressProblems(config)...)); err != nil {
+		return err
 	}
 	if err := InterfaceDown(vethChild); err != nil {
 		return fmt.Errorf("interface down %s %s", vethChild, err)
 	}
-	if err := ChangeInterfaceName(vethChild, defaultDevice); err != nil {
-		return fmt.Errorf("change %s to %s %s", vethChild, defaultDevice, err)
+	if err := ChangeInterfaceName(vethChild, device); err != nil {
+		return fmt.Errorf("change %s to %s %s", vethChild, device, err)
+	}
+	if err := configureInterface(config, device); err != nil {
+		resetInterface(device, vethChild)
+		return err
+	}
+	return nil
+}
+
+// configureInterface sets up the renamed device inside the container
+func configureInterface(config *Network, device string) error {
+	if !config.KeepAddresses {
+		if err := FlushInterfaceAddresses(device); err != nil {
+			return fmt.Errorf("flush %s addresses %s", device, err)
+		}
+	}
+	if config.DisableIPv6 {
+		if err := SetIPv6Disabled(device, true); err != nil {
+			return fmt.Errorf("disable %s ipv6 %s", device, err)
+		}
+	}
+	if config.AcceptRA != 0 {
+		if err := SetAcceptRA(device, config.AcceptRA); err != nil {
+			return fmt.Errorf("set %s accept_ra to %d %s", device, config.AcceptRA, err)
+		}
+	}
+	if config.ArpIgnore != 0 || config.ArpAnnounce != 0 {
+		if err := SetArp(device, config.ArpIgnore, config.ArpAnnounce); err != nil {
+			return fmt.Errorf("set %s arp_ignore to %d and arp_announce to %d %s", device, config.ArpIgnore, config.ArpAnnounce, err)
+		}
+	}
+	if macAddress := macAddress(config); macAddress != "" {
+		if err := SetInterfaceMac(device, macAddress); err != nil {
+			return fmt.Errorf("set %s mac %s", device, err)
+		}
+	}
+	// enslaving cycles the device, which drops its global ipv6 addresses,
+	// so it is done before the addresses are set
+	if config.VRF != "" {
+		if err := SetInterfaceVRF(device, config.VRF); err != nil {
+			return fmt.Errorf("set %s vrf to %s %s", device, config.VRF, err)
+		}
+	}
+	if err := setAddresses(config, device); err != nil {
+		return err
+	}
+
+	if config.Mtu != 0 && config.Mtu != InheritBridgeMtu {
+		if err := SetMtu(device, config.Mtu); err != nil {
+			return fmt.Errorf("set %s mtu to %d %s", device, config.Mtu, err)
+		}
+	}
+	if config.TxQueueLen != 0 {
+		if err := SetTxQueueLen(device, config.TxQueueLen); err != nil {
+			return fmt.Errorf("set %s txqueuelen to %d %s", device, config.TxQueueLen, err)
+		}
+	}
+	for _, feature := range offloadFeatures(config.Offloads) {
+		if err := SetOffload(device, feature, config.Offloads[feature]); err != nil {
+			return fmt.Errorf("set %s offload %s %s", device, feature, err)
+		}
+	}
+	if err := InterfaceUp(device); err != nil {
+		return fmt.Errorf("%s up %s", device, err)
+	}
+	if config.Promiscuous {
+		if err := SetInterfacePromiscuous(device, true); err != nil {
+			return fmt.Errorf("set %s promiscuous %s", device, err)
+		}
+	}
+	for _, neighbor := range config.Neighbors {
+		if err := AddNeighbor(device, neighbor.IP, neighbor.MacAddress); err != nil {
+			return fmt.Errorf("add neighbor %s on device %s failed with %s", neighbor.IP, device, err)
+		}
 	}
-	if config.MacAddress != "" {
-		if err := SetInterfaceMac(defaultDevice, config.MacAddress); err != nil {
-			return fmt.Errorf("set %s mac %s", defaultDevice, err)
+	if err := setRoutes(config, device, false); err != nil {
+		return err
+	}
+	if config.WaitForUp {
+		if err := WaitForInterfaceUp(device, waitForUpTimeout); err != nil {
+			return err
 		}
 	}
-	if err := SetInterfaceIp(defaultDevice, config.Address); err != nil {
-		return fmt.Errorf("set %s ip %s", defaultDevice, err)
+	return nil
+}
+
+// resetInterface brings the device down and renames it back to vethChild after
+// it failed to be configured so that initializing it again starts fresh
+func resetInterface(device, vethChild string) {
+	InterfaceDown(device)
+	ChangeInterfaceName(device, vethChild)
+}
+
+// Reconfigure replaces the addresses, gateways, routes and rules of a container's
+// interface that has already been initialized with the ones in config.  The rules
+// recorded in the network state are removed and replaced by the ones in config, so
+// the caller has to keep the updated state.  It has to be called from inside the
+// container's network namespace and can be called repeatedly.
+func (v *Veth) Reconfigure(config *Network, networkState *NetworkState) error {
+	device := networkState.Interface
+	if device == "" {
+		device = interfaceName(config)
+	}
+	if err := joinProblems(addressProblems(config)); err != nil {
+		return err
+	}
+	if err := FlushInterfaceAddresses(device); err != nil {
+		return fmt.Errorf("flush %s addresses %s", device, err)
+	}
+	// flushing the addresses does not remove ipv6 gateways or any rule
+	if err := DeleteDefaultRoutes(device); err != nil {
+		return fmt.Errorf("delete default routes on device %s failed with %s", device, err)
 	}
-	if config.IPv6Address != "" {
-		if err := SetInterfaceIp(defaultDevice, config.IPv6Address); err != nil {
-			return fmt.Errorf("set %s ipv6 %s", defaultDevice, err)
+	for _, rule := range networkState.Rules {
+		if err := DeleteRule(rule.From, rule.To, rule.Table, rule.Priority); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("delete rule from %s to %s for table %d failed with %s", rule.From, rule.To, rule.Table, err)
 		}
 	}
+	networkState.Rules = nil
+	if err := setAddresses(config, device); err != nil {
+		return err
+	}
+	if err := setRoutes(config, device, true); err != nil {
+		return err
+	}
+	networkState.Rules = config.Rules
+	return nil
+}
 
-	if err := SetMtu(defaultDevice, config.Mtu); err != nil {
-		return fmt.Errorf("set %s mtu to %d %s", defaultDevice, config.Mtu, err)
+// setAddresses sets the IPv4 and IPv6 addresses in config on the device
+func setAddresses(config *Network, device string) error {
+	for _, address := range joinAddresses(config.Address, config.Addresses) {
+		if err := SetInterfaceIp(device, address); err != nil {
+			return addressError(device, address, err)
+		}
 	}
-	if err := InterfaceUp(defaultDevice); err != nil {
-		return fmt.Errorf("%s up %s", defaultDevice, err)
+	for _, address := range joinAddresses(config.IPv6Address, config.IPv6Addresses) {
+		if err := SetInterfaceIp(device, address); err != nil {
+			return addressError(device, address, err)
+		}
 	}
-	if config.Gateway != "" {
-		if err := SetDefaultGateway(config.Gateway, defaultDevice); err != nil {
-			return fmt.Errorf("set gateway to %s on device %s failed with %s", config.Gateway, defaultDevice, err)
+	return nil
+}
+
+// setRoutes sets the default gateways, routes and rules in config on the device.
+// When keepExisting is true routes that are already present are not an error.
+func setRoutes(config *Network, device string, keepExisting bool) error {
+	if len(joinAddresses(config.Address, config.Addresses)) > 0 && config.Gateway != "" {
+		if err := setDefaultGateway(config.Gateway, device, config.GatewayOnLink); err != nil {
+			return fmt.Errorf("set gateway to %s on device %s failed with %s", config.Gateway, device, err)
 		}
 	}
 	if config.IPv6Gateway != "" {
-		if err := SetDefaultGateway(config.IPv6Gateway, defaultDevice); err != nil {
-			return fmt.Errorf("set gateway for ipv6 to %s on device %s failed with %s", config.IPv6Gateway, defaultDevice, err)
+		if err := setDefaultGateway(config.IPv6Gateway, device, config.GatewayOnLink); err != nil {
+			return fmt.Errorf("set gateway for ipv6 to %s on device %s failed with %s", config.IPv6Gateway, device, err)
+		}
+	}
+	for _, route := range config.Routes {
+		if err := AddRoute(route.Destination, route.Gateway, device, route.Metric, route.Table); err != nil && !(keepExisting && os.IsExist(err)) {
+			return fmt.Errorf("add route to %s via %s on device %s failed with %s", route.Destination, route.Gateway, device, err)
+		}
+	}
+	for _, rule := range config.Rules {
+		if err := AddRule(rule.From, rule.To, rule.Table, rule.Priority); err != nil {
+			return fmt.Errorf("add rule from %s to %s for table %d failed with %s", rule.From, rule.To, rule.Table, err)
+		}
+	}
+	if config.NoDefaultRoute {
+		if err := DeleteDefaultRoutes(device); err != nil {
+			return fmt.Errorf("delete default routes on device %s failed with %s", device, err)
+		}
+	}
+	return nil
+}
+
+// setDefaultGateway sets the default gateway of the device, on link when the
+// gateway can be outside of the device's subnets
+func setDefaultGateway(gateway, device string, onLink bool) error {
+	if onLink {
+		return SetDefaultGatewayOnLink(gateway, device)
+	}
+	return SetDefaultGateway(gateway, device)
+}
+
+// Delete removes the host side of the veth pair recorded in the network state,
+// which also removes its peer.  Deleting a pair that no longer exists, for example
+// because the container's network namespace was already destroyed, is not an error.
+func (v *Veth) Delete(n *Network, networkState *NetworkState) error {
+	return deleteHostInterface(networkState.VethHost)
+}
+
+// interfaceName returns the name the interface is given inside the container
+func interfaceName(n *Network) string {
+	if n.InterfaceName != "" {
+		return n.InterfaceName
+	}
+	return defaultDevice
+}
+
+// macAddress returns the mac address to set on the interface inside the container
+// or an empty string to keep the one it already has
+func macAddress(n *Network) string {
+	if n.MacAddress == "" && n.DeriveMacFromID {
+		return GenerateMacFromID(n.ContainerID)
+	}
+	return n.MacAddress
+}
+
+// deleteHostInterface removes the interface name if it exists on the host
+func deleteHostInterface(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := net.InterfaceByName(name); err != nil {
+		return nil
+	}
+	if err := DeleteInterface(name); err != nil {
+		return fmt.Errorf("delete %s %s", name, err)
+	}
+	return nil
+}
+
+// recordDNS adds the nameservers and search domains of n to the network state
+// so that the caller can write the container's resolv.conf
+func recordDNS(n *Network, networkState *NetworkState) {
+	networkState.DNS = append(networkState.DNS, n.DNS...)
+	networkState.DNSSearch = append(networkState.DNSSearch, n.DNSSearch...)
+}
+
+// moveToNamespace moves the interface name with the given index into the network
+// namespace at the NamespacePath of n, the namespace with the NamespaceInode of n or, when
+// neither is set, into the network namespace of nspid.  The interface is moved by
+// its index so that the move can not race with the interface being renamed.
+func moveToNamespace(index int, name string, n *Network, nspid int) error {
+	nsPath := n.NamespacePath
+	if nsPath == "" && n.NamespaceInode != 0 {
+		path, err := FindNamespaceByInode(n.NamespaceInode)
+		if err != nil {
+			return wrapError(ErrNamespaceMoveFailed, err, "move %s to namespace inode %d", name, n.NamespaceInode)
 		}
+		nsPath = path
+	}
+	if nsPath != "" {
+		if err := SetInterfaceIndexInNamespacePath(index, nsPath); err != nil {
+			return wrapError(ErrNamespaceMoveFailed, err, "move %s to %s", name, nsPath)
+		}
+		return nil
+	}
+	if err := SetInterfaceIndexInNamespacePid(index, nspid); err != nil {
+		return wrapError(ErrNamespaceMoveFailed, err, "move %s to pid %d", name, nspid)
 	}
 	return nil
 }
 
+// deleteMovedInterface deletes the child interface recorded in the network state
+// from the network namespace that moveToNamespace moved it into.  The interface
+// is looked up by its index, which it keeps across the move, and is left alone
+// if it was never moved or has already been removed.
+func deleteMovedInterface(n *Network, nspid int, networkState *NetworkState) error {
+	if networkState.VethChildIndex == 0 {
+		return nil
+	}
+	nsPath := n.NamespacePath
+	if nsPath == "" && n.NamespaceInode != 0 {
+		path, err := FindNamespaceByInode(n.NamespaceInode)
+		if err != nil {
+			// the interface can not have been moved into a namespace that is not found
+			return nil
+		}
+		nsPath = path
+	}
+	if nsPath == "" {
+		nsPath = fmt.Sprintf("/proc/%d/ns/net", nspid)
+	}
+	// interfaces are removed together with their namespace
+	if _, err := os.Stat(nsPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	return inNamespace(nsPath, func() error {
+		iface, err := net.InterfaceByIndex(networkState.VethChildIndex)
+		// the index may belong to another interface when the move failed
+		if err != nil || iface.Name != networkState.VethChild {
+			return nil
+		}
+		if err := DeleteInterface(iface.Name); err != nil {
+			return fmt.Errorf("delete %s in %s %s", iface.Name, nsPath, err)
+		}
+		return nil
+	})
+}
+
+// inNamespace runs f on a thread inside the network namespace at nsPath.  The
+// thread is only unlocked once it is back in its own namespace, otherwise it
+// exits together with the goroutine instead of being reused.
+func inNamespace(nsPath string, f func() error) error {
+	errs := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid()))
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer origin.Close()
+		target, err := os.Open(nsPath)
+		if err != nil {
+			errs <- err
+			return
+		}
+		err = system.Setns(target.Fd(), syscall.CLONE_NEWNET)
+		target.Close()
+		if err != nil {
+			errs <- fmt.Errorf("setns %s %s", nsPath, err)
+			return
+		}
+		err = f()
+		if system.Setns(origin.Fd(), syscall.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+		errs <- err
+	}()
+	return <-errs
+}
+
+// joinAddresses returns the primary address, if set, followed by the
+// additional addresses in the order they were configured
+func joinAddresses(primary string, additional []string) []string {
+	var addresses []string
+	if primary != "" {
+		addresses = append(addresses, primary)
+	}
+	return append(addresses, additional...)
+}
+
+// createBridge creates the bridge and brings it up, removing it again
+// if it cannot be brought up so that a retry starts from a clean host.
+// A bridge that another container created at the same time is only
+// brought up and left in place if that fails.  It reports whether the
+// bridge was created by this call.
+func createBridge(name string) (bool, error) {
+	if err := CreateBridge(name, true); err != nil {
+		if !os.IsExist(err) {
+			return false, fmt.Errorf("create bridge %s %s", name, err)
+		}
+		if err := InterfaceUp(name); err != nil {
+			return false, fmt.Errorf("bridge %s up %s", name, err)
+		}
+		return false, nil
+	}
+	if err := InterfaceUp(name); err != nil {
+		err = fmt.Errorf("bridge %s up %s", name, err)
+		if derr := DeleteBridge(name); derr != nil {
+			return true, fmt.Errorf("%s and delete bridge %s", err, derr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CreatePatchPort connects bridgeA and bridgeB with a veth pair that stays on the
+// host, one end attached to each bridge, and returns the names of both ends.
+// Deleting either end removes the patch port.
+func CreatePatchPort(bridgeA, bridgeB, prefix string) (string, string, error) {
+	if err := validateVethPrefix(prefix); err != nil {
+		return "", "", err
+	}
+	for _, bridge := range []string{bridgeA, bridgeB} {
+		if _, err := net.InterfaceByName(bridge); err != nil {
+			return "", "", newError(ErrBridgeNotFound, "bridge %s", bridge)
+		}
+	}
+	name1, name2, err := createVethPair(prefix, 0, 0)
+	if err != nil {
+		return "", "", err
+	}
+	// deleting one end of the pair removes the other one as well
+	rollback := func(err error) error {
+		if derr := DeleteInterface(name1); derr != nil {
+			return fmt.Errorf("%s and delete %s %s", err, name1, derr)
+		}
+		return err
+	}
+	for _, port := range [][2]string{{name1, bridgeA}, {name2, bridgeB}} {
+		if err := SetInterfaceMaster(port[0], port[1]); err != nil {
+			return "", "", rollback(fmt.Errorf("attach %s to bridge %s %s", port[0], port[1], err))
+		}
+		if err := InterfaceUp(port[0]); err != nil {
+			return "", "", rollback(fmt.Errorf("%s up %s", port[0], err))
+		}
+	}
+	return name1, name2, nil
+}
+
+// vethSuffixLength returns the length of the random suffix appended to prefix
+// so that the resulting names fit in IFNAMSIZ.  A zero length selects the default
+// length, shortened if the prefix does not leave enough room for it.
+func vethSuffixLength(prefix string, length int) (int, error) {
+	max := maxInterfaceNameLength - len(prefix)
+	if max < 1 {
+		return 0, fmt.Errorf("veth prefix %q leaves no room for a suffix within %d characters", prefix, maxInterfaceNameLength)
+	}
+	if length < 0 || length > max {
+		return 0, fmt.Errorf("veth suffix length %d is not 0 for the default or between 1 and %d for prefix %q", length, max, prefix)
+	}
+	if length == 0 {
+		length = defaultVethSuffixLength
+		if length > max {
+			length = max
+		}
+	}
+	return length, nil
+}
+
 // createVethPair will automatically generage two random names for
 // the veth pair and ensure that they have been created
-func createVethPair(prefix string, txQueueLen int) (name1 string, name2 string, err error) {
+func createVethPair(prefix string, suffixLength, txQueueLen int) (name1 string, name2 string, err error) {
+	if suffixLength, err = vethSuffixLength(prefix, suffixLength); err != nil {
+		return
+	}
+
 	for i := 0; i < 10; i++ {
-		if name1, err = utils.GenerateRandomName(prefix, 7); err != nil {
+		if name1, err = utils.GenerateRandomName(prefix, suffixLength); err != nil {
 			return
 		}
 
-		if name2, err = utils.GenerateRandomName(prefix, 7); err != nil {
+		if name2, err = utils.GenerateRandomName(prefix, suffixLength); err != nil {
 			return
 		}
 
@@ -3,7 +3,20 @@
 package network
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/docker/libcontainer/netlink"
 )
@@ -15,7 +28,7 @@ func TestGenerateVethNames(t *testing.T) {
 
 	prefix := "veth"
 
-	name1, name2, err := createVethPair(prefix, 0)
+	name1, name2, err := createVethPair(prefix, 0, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -29,6 +42,58 @@ func TestGenerateVethNames(t *testing.T) {
 	}
 }
 
+func TestVethSuffixLength(t *testing.T) {
+	for _, test := range []struct {
+		prefix   string
+		length   int
+		expected int
+	}{
+		{"veth", 0, defaultVethSuffixLength},
+		{"veth", 11, 11},
+		{"vethabcdefgh", 0, 3},
+		{"vethabcdefgh", 2, 2},
+	} {
+		length, err := vethSuffixLength(test.prefix, test.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length != test.expected {
+			t.Fatalf("expected suffix length %d for %q but received %d", test.expected, test.prefix, length)
+		}
+	}
+
+	for _, test := range []struct {
+		prefix string
+		length int
+	}{
+		{"vethabcdefghijk", 0},
+		{"veth", 12},
+		{"veth", -1},
+	} {
+		if _, err := vethSuffixLength(test.prefix, test.length); err == nil {
+			t.Fatalf("expected suffix length %d for %q to be invalid", test.length, test.prefix)
+		}
+	}
+}
+
+func TestGenerateVethNamesWithLongPrefix(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	name1, name2, err := createVethPair("vethabcdefgh", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	for _, name := range []string{name1, name2} {
+		if len(name) > maxInterfaceNameLength {
+			t.Fatalf("expected %s to be at most %d characters", name, maxInterfaceNameLength)
+		}
+	}
+}
+
 func TestCreateDuplicateVethPair(t *testing.T) {
 	if testing.Short() {
 		return
@@ -36,7 +101,7 @@ func TestCreateDuplicateVethPair(t *testing.T) {
 
 	prefix := "veth"
 
-	name1, name2, err := createVethPair(prefix, 0)
+	name1, name2, err := createVethPair(prefix, 0, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -51,3 +116,1304 @@ func TestCreateDuplicateVethPair(t *testing.T) {
 		t.Fatalf("expected error to be ErrInterfaceExists but received %q", err)
 	}
 }
+
+func TestDeleteMissingVethPair(t *testing.T) {
+	v := &Veth{}
+
+	if err := v.Delete(&Network{}, &NetworkState{}); err != nil {
+		t.Fatalf("expected no error without a recorded veth but received %q", err)
+	}
+
+	if err := v.Delete(&Network{}, &NetworkState{VethHost: "vethmissing0"}); err != nil {
+		t.Fatalf("expected deleting a missing veth to be a no-op but received %q", err)
+	}
+}
+
+func TestCreateWithMissingBridge(t *testing.T) {
+	v := &Veth{}
+	n := &Network{
+		Bridge:     "brmissing0",
+		VethPrefix: "veth",
+	}
+
+	state := &NetworkState{}
+	if err := v.Create(n, 1, state); !errors.Is(err, ErrBridgeNotFound) {
+		t.Fatalf("expected error to be %q but received %v", ErrBridgeNotFound, err)
+	}
+
+	if state.VethHost != "" || state.VethChild != "" {
+		t.Fatalf("expected no veth pair to be created but received %q and %q", state.VethHost, state.VethChild)
+	}
+}
+
+func TestCreateWithoutBridgeOrPrefix(t *testing.T) {
+	v := &Veth{}
+
+	for _, prefix := range []string{"veth-", "Veth", "vethabcdefghijk"} {
+		if err := v.Create(&Network{Bridge: "br0", VethPrefix: prefix}, 1, &NetworkState{}); err == nil || errors.Is(err, ErrBridgeNotFound) {
+			t.Fatalf("expected veth prefix %q to be rejected but received %v", prefix, err)
+		}
+	}
+
+	if err := v.Create(&Network{VethPrefix: "veth"}, 1, &NetworkState{}); err != ErrBridgeNotSpecified {
+		t.Fatalf("expected error to be %q but received %v", ErrBridgeNotSpecified, err)
+	}
+	if err := v.Create(&Network{Bridge: "br0"}, 1, &NetworkState{}); err != ErrVethPrefixNotSpecified {
+		t.Fatalf("expected error to be %q but received %v", ErrVethPrefixNotSpecified, err)
+	}
+	if err := v.Initialize(&Network{}, &NetworkState{}); err != ErrVethChildNotSpecified {
+		t.Fatalf("expected error to be %q but received %v", ErrVethChildNotSpecified, err)
+	}
+}
+
+func TestSetAddressesConflict(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	name1, _, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	n := &Network{Address: "10.99.0.2/24"}
+	if err := setAddresses(n, name1); err != nil {
+		t.Fatal(err)
+	}
+	if err := setAddresses(n, name1); !errors.Is(err, ErrAddressConflict) {
+		t.Fatalf("expected error to be %q but received %v", ErrAddressConflict, err)
+	}
+}
+
+func TestCreateInNamespacePath(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	if err := exec.Command("ip", "netns", "add", "tstns0").Run(); err != nil {
+		t.Skipf("unable to create a named network namespace: %s", err)
+	}
+	defer exec.Command("ip", "netns", "delete", "tstns0").Run()
+
+	bridge := "testbr3"
+	if _, err := createBridge(bridge); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteBridge(bridge)
+
+	v := &Veth{}
+	n := &Network{
+		Bridge:        bridge,
+		VethPrefix:    "veth",
+		NamespacePath: "/var/run/netns/tstns0",
+	}
+	state := &NetworkState{}
+	if err := v.Create(n, 1<<30, state); err != nil {
+		t.Fatal(err)
+	}
+	defer v.Delete(n, state)
+
+	if _, err := net.InterfaceByName(state.VethChild); err == nil {
+		t.Fatalf("expected %s to be moved out of the host namespace", state.VethChild)
+	}
+	out, err := exec.Command("ip", "netns", "exec", "tstns0", "ip", "link", "show", state.VethChild).CombinedOutput()
+	if err != nil {
+		t.Fatalf("expected %s to be in the namespace but received %q: %s", state.VethChild, err, out)
+	}
+
+	// ns_path belongs to the netns strategy and does not change where a veth is moved
+	n = &Network{
+		Bridge:     bridge,
+		VethPrefix: "veth",
+		NsPath:     "/var/run/netns/tstns0",
+	}
+	state = &NetworkState{}
+	if err := v.Create(n, 1<<30, state); !errors.Is(err, ErrNamespaceMoveFailed) {
+		t.Fatalf("expected error to be %q with an invalid pid but received %v", ErrNamespaceMoveFailed, err)
+	}
+	v.Delete(n, state)
+
+	n = &Network{
+		Bridge:        bridge,
+		VethPrefix:    "veth",
+		NamespacePath: "/var/run/netns/missing0",
+	}
+	state = &NetworkState{}
+	if err := v.Create(n, 1<<30, state); !errors.Is(err, ErrNamespaceMoveFailed) {
+		t.Fatalf("expected error to be %q with a missing namespace path but received %v", ErrNamespaceMoveFailed, err)
+	}
+	v.Delete(n, state)
+}
+
+func TestFindNamespaceByInode(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	if err := exec.Command("ip", "netns", "add", "tstns1").Run(); err != nil {
+		t.Skipf("unable to create a named network namespace: %s", err)
+	}
+	defer exec.Command("ip", "netns", "delete", "tstns1").Run()
+
+	fi, err := os.Stat("/var/run/netns/tstns1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode := fi.Sys().(*syscall.Stat_t).Ino
+
+	path, err := FindNamespaceByInode(inode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := os.Stat(path); err != nil || !os.SameFile(fi, found) {
+		t.Fatalf("expected %s to be the namespace with inode %d", path, inode)
+	}
+
+	name1, name2, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	child, err := net.InterfaceByName(name2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := moveToNamespace(child.Index, name2, &Network{NamespaceInode: inode}, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.InterfaceByName(name2); err == nil {
+		t.Fatalf("expected %s to be moved into the namespace with inode %d", name2, inode)
+	}
+
+	if _, err := FindNamespaceByInode(0); err == nil {
+		t.Fatal("expected error to not be nil for a missing namespace inode")
+	}
+}
+
+func TestMoveToNamespaceByIndex(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	if err := exec.Command("ip", "netns", "add", "tstns2").Run(); err != nil {
+		t.Skipf("unable to create a named network namespace: %s", err)
+	}
+	defer exec.Command("ip", "netns", "delete", "tstns2").Run()
+
+	name1, name2, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	child, err := net.InterfaceByName(name2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// renaming the interface after its index was captured must not affect the move
+	if err := ChangeInterfaceName(name2, "tstrenamed0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveToNamespace(child.Index, name2, &Network{NamespacePath: "/var/run/netns/tstns2"}, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := net.InterfaceByName("tstrenamed0"); err == nil {
+		t.Fatal("expected the renamed interface to be moved into the namespace")
+	}
+	out, err := exec.Command("ip", "netns", "exec", "tstns2", "ip", "link", "show", "tstrenamed0").CombinedOutput()
+	if err != nil {
+		t.Fatalf("expected the renamed interface to be in the namespace but received %q: %s", err, out)
+	}
+}
+
+func TestCreateRecordsDNS(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	bridge := "testbr4"
+	if _, err := createBridge(bridge); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteBridge(bridge)
+
+	v := &Veth{}
+	n := &Network{
+		Bridge:     bridge,
+		VethPrefix: "veth",
+		DNS:        []string{"10.96.0.10", "10.96.0.11"},
+		DNSSearch:  []string{"example.com"},
+	}
+
+	state := &NetworkState{DNS: []string{"10.95.0.10"}}
+	v.Create(n, 1<<30, state)
+	defer v.Delete(n, state)
+
+	if expected := []string{"10.95.0.10", "10.96.0.10", "10.96.0.11"}; !reflect.DeepEqual(state.DNS, expected) {
+		t.Fatalf("expected dns to be %v but received %v", expected, state.DNS)
+	}
+	if !reflect.DeepEqual(state.DNSSearch, n.DNSSearch) {
+		t.Fatalf("expected dns search to be %v but received %v", n.DNSSearch, state.DNSSearch)
+	}
+}
+
+func TestCreateBridge(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	name := "testbr0"
+	created, err := createBridge(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteBridge(name)
+	if !created {
+		t.Fatalf("expected bridge %s to be reported as created", name)
+	}
+
+	if _, err := net.InterfaceByName(name); err != nil {
+		t.Fatalf("expected bridge %s to exist but received %q", name, err)
+	}
+
+	// another container creating the same bridge must not fail
+	if created, err = createBridge(name); err != nil {
+		t.Fatalf("expected creating an existing bridge to succeed but received %q", err)
+	}
+	if created {
+		t.Fatalf("expected existing bridge %s to not be reported as created", name)
+	}
+}
+
+func TestCreateBridgeConcurrently(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	var (
+		v      = &Veth{}
+		n      = &Network{Bridge: "testbr10", VethPrefix: "veth", CreateBridge: true}
+		errs   = make(chan error, 2)
+		states = []*NetworkState{{}, {}}
+	)
+	defer DeleteBridge(n.Bridge)
+	for _, state := range states {
+		go func(state *NetworkState) {
+			// the move into the namespace fails so only check that the bridge was found
+			errs <- v.Create(n, 1<<30, state)
+		}(state)
+	}
+	for range states {
+		if err := <-errs; !errors.Is(err, ErrNamespaceMoveFailed) {
+			t.Fatalf("expected error to be %q but received %v", ErrNamespaceMoveFailed, err)
+		}
+	}
+	for _, state := range states {
+		v.Delete(n, state)
+	}
+}
+
+func TestCreateBridgeWithSTP(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	v := &Veth{}
+	n := &Network{
+		Bridge:     "testbr5",
+		VethPrefix: "veth",
+		EnableSTP:  true,
+	}
+	if err := v.Create(n, 1<<30, &NetworkState{}); err == nil {
+		t.Fatal("expected error to not be nil when enabling stp without creating the bridge")
+	}
+
+	n.CreateBridge = true
+	state := &NetworkState{}
+	v.Create(n, 1<<30, state)
+	defer DeleteBridge(n.Bridge)
+	defer v.Delete(n, state)
+
+	data, err := ioutil.ReadFile("/sys/class/net/testbr5/bridge/stp_state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := strings.TrimSpace(string(data)); value == "0" {
+		t.Fatalf("expected stp to be enabled but received stp_state %q", value)
+	}
+}
+
+func TestCreatePatchPort(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	if _, _, err := CreatePatchPort("brmissing0", "brmissing1", "patch"); !errors.Is(err, ErrBridgeNotFound) {
+		t.Fatalf("expected error to be %q but received %v", ErrBridgeNotFound, err)
+	}
+
+	for _, bridge := range []string{"testbr8", "testbr9"} {
+		if _, err := createBridge(bridge); err != nil {
+			t.Fatal(err)
+		}
+		defer DeleteBridge(bridge)
+	}
+
+	name1, name2, err := CreatePatchPort("testbr8", "testbr9", "patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	for _, port := range [][3]string{{name1, "testbr8", name2}, {name2, "testbr9", name1}} {
+		master, err := os.Readlink(filepath.Join("/sys/class/net", port[0], "master"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(master) != port[1] {
+			t.Fatalf("expected %s to be attached to %s but received %s", port[0], port[1], filepath.Base(master))
+		}
+
+		// the iflink of a veth is the index of its peer
+		data, err := ioutil.ReadFile(filepath.Join("/sys/class/net", port[0], "iflink"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer, err := net.InterfaceByName(port[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if iflink := strings.TrimSpace(string(data)); iflink != fmt.Sprint(peer.Index) {
+			t.Fatalf("expected the peer of %s to be %s but received index %s", port[0], port[2], iflink)
+		}
+	}
+}
+
+func TestJoinAddresses(t *testing.T) {
+	addresses := joinAddresses("10.0.0.2/24", []string{"10.0.1.2/24", "10.0.2.2/24"})
+
+	expected := []string{"10.0.0.2/24", "10.0.1.2/24", "10.0.2.2/24"}
+	if len(addresses) != len(expected) {
+		t.Fatalf("expected %d addresses but received %d", len(expected), len(addresses))
+	}
+	for i, address := range expected {
+		if addresses[i] != address {
+			t.Fatalf("expected address %d to be %s but received %s", i, address, addresses[i])
+		}
+	}
+
+	if addresses := joinAddresses("", nil); len(addresses) != 0 {
+		t.Fatalf("expected no addresses but received %v", addresses)
+	}
+}
+
+func TestInitializeSetsAddressesInOrder(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		Address:       "10.89.0.2/24",
+		Addresses:     []string{"10.89.1.2/24", "10.89.2.2/24"},
+		IPv6Address:   "fd00:20::2/64",
+		IPv6Addresses: []string{"fd00:21::2/64", "fd00:22::2/64"},
+	}
+	var addresses []string
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		iface, err := net.InterfaceByName(defaultDevice)
+		if err != nil {
+			return err
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			if ip, _, err := net.ParseCIDR(addr.String()); err == nil && !ip.IsLinkLocalUnicast() {
+				addresses = append(addresses, addr.String())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the kernel lists ipv4 addresses in the order they were added and
+	// ipv6 addresses with the most recently added first
+	expected := []string{
+		"10.89.0.2/24", "10.89.1.2/24", "10.89.2.2/24",
+		"fd00:22::2/64", "fd00:21::2/64", "fd00:20::2/64",
+	}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("expected addresses %v but received %v", expected, addresses)
+	}
+}
+
+func TestCreateRecordsStateOnFailure(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	bridge := "testbr1"
+	if _, err := createBridge(bridge); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteBridge(bridge)
+
+	v := &Veth{}
+	n := &Network{
+		Bridge:     bridge,
+		VethPrefix: "veth",
+	}
+
+	// no process can have this pid so the move into the namespace fails
+	state := &NetworkState{}
+	if err := v.Create(n, 1<<30, state); !errors.Is(err, ErrNamespaceMoveFailed) {
+		t.Fatalf("expected error to be %q but received %v", ErrNamespaceMoveFailed, err)
+	}
+	defer v.Delete(n, state)
+
+	if state.VethHost == "" || state.VethChild == "" {
+		t.Fatal("expected the veth pair to be recorded in the network state")
+	}
+
+	if state.Interface != defaultDevice {
+		t.Fatalf("expected the container interface to be %s but received %q", defaultDevice, state.Interface)
+	}
+}
+
+func TestCreateInheritsBridgeMtu(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	bridge := "testbr2"
+	if _, err := createBridge(bridge); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteBridge(bridge)
+
+	mtu := 1400
+	if err := SetMtu(bridge, mtu); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &Veth{}
+	n := &Network{
+		Bridge:     bridge,
+		VethPrefix: "veth",
+		Mtu:        InheritBridgeMtu,
+	}
+
+	// the move into the namespace fails but both mtus are set before that
+	state := &NetworkState{}
+	v.Create(n, 1<<30, state)
+	defer v.Delete(n, state)
+
+	for _, name := range []string{state.VethHost, state.VethChild} {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if iface.MTU != mtu {
+			t.Fatalf("expected %s mtu to be %d but received %d", name, mtu, iface.MTU)
+		}
+	}
+}
+
+func TestSetIPv6Disabled(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	name1, name2, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	if err := SetIPv6Disabled(name2, true); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(interfaceSysctlPath("ipv6", name2, "disable_ipv6"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := strings.TrimSpace(string(data)); value != "1" {
+		t.Fatalf("expected disable_ipv6 to be 1 but received %q", value)
+	}
+}
+
+func TestInitializeSetsTxQueueLen(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		TxQueueLen: 2000,
+	}
+	var value string
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		value, err = readNetworkSysfs(defaultDevice, "tx_queue_len")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "2000" {
+		t.Fatalf("expected tx_queue_len to be 2000 but received %q", value)
+	}
+}
+
+func TestInitializeSetsOffloads(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	// a veth has its checksum and segmentation offloads enabled by default
+	n := &Network{
+		Offloads: map[string]bool{"tx": false, "tso": false, "rx": true},
+	}
+	enabled := make(map[string]bool)
+	var unknownErr, lookupErr error
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		for feature := range n.Offloads {
+			if enabled[feature], err = GetOffload(defaultDevice, feature); err != nil {
+				return err
+			}
+		}
+
+		unknown := &Network{Offloads: map[string]bool{"unknown": false}}
+		unknownErr = initializeInterface(unknown, &NetworkState{VethChild: defaultDevice})
+		_, lookupErr = net.InterfaceByName(defaultDevice)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for feature, expected := range n.Offloads {
+		if enabled[feature] != expected {
+			t.Fatalf("expected offload %s to be enabled %v but received %v", feature, expected, enabled[feature])
+		}
+	}
+	if unknownErr == nil {
+		t.Fatal("expected error to not be nil for an unknown offload")
+	}
+	if lookupErr != nil {
+		t.Fatal("expected the interface to be left alone with an unknown offload")
+	}
+}
+
+func TestInitializeSetsAcceptRA(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		AcceptRA: 2,
+	}
+	var (
+		value string
+		addrs []net.Addr
+	)
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(interfaceSysctlPath("ipv6", defaultDevice, "accept_ra"))
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSpace(string(data))
+
+		iface, err := net.InterfaceByName(defaultDevice)
+		if err != nil {
+			return err
+		}
+		addrs, err = iface.Addrs()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "2" {
+		t.Fatalf("expected accept_ra to be 2 but received %q", value)
+	}
+	for _, addr := range addrs {
+		if ip, _, err := net.ParseCIDR(addr.String()); err == nil && ip.To4() == nil && !ip.IsLinkLocalUnicast() {
+			t.Fatalf("expected no static ipv6 address but received %s", addr)
+		}
+	}
+}
+
+func TestNoDefaultRoute(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+
+		if err := initializeInterface(&Network{
+			NoDefaultRoute: true,
+			Gateway:        "10.97.0.1",
+		}, &NetworkState{VethChild: name2}); err == nil {
+			return errors.New("expected error to not be nil with a gateway and no default route")
+		}
+		if err := initializeInterface(&Network{
+			NoDefaultRoute: true,
+			AcceptRA:       1,
+		}, &NetworkState{VethChild: name2}); err == nil {
+			return errors.New("expected error to not be nil when accepting router advertisements and no default route")
+		}
+
+		n := &Network{
+			Address:        "10.97.0.2/24",
+			NoDefaultRoute: true,
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+
+		if err := AddRoute("0.0.0.0/0", "10.97.0.1", defaultDevice, 0, 0); err != nil {
+			return err
+		}
+		if err := AddRoute("::/0", "", defaultDevice, 0, 0); err != nil {
+			return err
+		}
+		if err := setRoutes(n, defaultDevice, true); err != nil {
+			return err
+		}
+
+		for _, family := range []string{"-4", "-6"} {
+			out, err := exec.Command("ip", family, "route", "show", "default", "dev", defaultDevice).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("unable to list routes: %s: %s", err, out)
+			}
+			if len(strings.TrimSpace(string(out))) != 0 {
+				return fmt.Errorf("expected no default route to remain but received %q", out)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitializeSetsVRF(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	// enslaving uses netlink so a bridge can stand in for a vrf device on
+	// kernels without vrf support
+	vrf := "testbr7"
+	if err := exec.Command("ip", "link", "add", "testvrf0", "type", "vrf", "table", "10").Run(); err == nil {
+		vrf = "testvrf0"
+		defer DeleteInterface(vrf)
+		if err := InterfaceUp(vrf); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		if _, err := createBridge(vrf); err != nil {
+			t.Fatal(err)
+		}
+		defer DeleteBridge(vrf)
+	}
+
+	name1, name2, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	n := &Network{
+		InterfaceName: "tstvrf0",
+		IPv6Address:   "fd00:83::2/64",
+		VRF:           vrf,
+	}
+	if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+		t.Fatal(err)
+	}
+
+	master, err := os.Readlink("/sys/class/net/tstvrf0/master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(master) != vrf {
+		t.Fatalf("expected master to be %s but received %s", vrf, filepath.Base(master))
+	}
+
+	iface, err := net.InterfaceByName("tstvrf0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, addr := range addrs {
+		if addr.String() == n.IPv6Address {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected %s to remain after enslaving but received %v", n.IPv6Address, addrs)
+	}
+}
+
+// inNewNetworkNamespace runs f on a thread in a new network namespace so that it
+// can change routes without affecting the host
+func inNewNetworkNamespace(f func() error) error {
+	errs := make(chan error, 1)
+	go func() {
+		// the thread is not unlocked so that it exits along with its namespace
+		runtime.LockOSThread()
+		if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+			errs <- err
+			return
+		}
+		errs <- f()
+	}()
+	return <-errs
+}
+
+// readNetworkSysfs reads a file of device from a sysfs mounted in the network
+// namespace of the calling thread, the host's /sys only lists the host's devices
+func readNetworkSysfs(device, file string) (string, error) {
+	out, err := exec.Command("unshare", "-m", "sh", "-c", `mount -t sysfs sysfs /sys && cat "/sys/class/net/$0/$1"`, device, file).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("read %s of %s: %s: %s", file, device, err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func TestInitializeSetsPromiscuous(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	for _, promiscuous := range []bool{true, false} {
+		var flags string
+		err := inNewNetworkNamespace(func() error {
+			_, name2, err := createVethPair("veth", 0, 0)
+			if err != nil {
+				return err
+			}
+			if err := initializeInterface(&Network{Promiscuous: promiscuous}, &NetworkState{VethChild: name2}); err != nil {
+				return err
+			}
+			flags, err = readNetworkSysfs(defaultDevice, "flags")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := strconv.ParseUint(flags, 0, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enabled := value&syscall.IFF_PROMISC != 0; enabled != promiscuous {
+			t.Fatalf("expected promiscuous mode to be %v but received flags %s", promiscuous, flags)
+		}
+	}
+}
+
+func TestInitializeGatewaySubnet(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	for _, test := range []struct {
+		gateway string
+		onLink  bool
+		valid   bool
+	}{
+		{"10.94.0.1", false, true},
+		{"10.93.0.1", false, false},
+		{"10.93.0.1", true, true},
+	} {
+		n := &Network{
+			Address:       "10.94.0.2/24",
+			Gateway:       test.gateway,
+			GatewayOnLink: test.onLink,
+		}
+		err := inNewNetworkNamespace(func() error {
+			_, name2, err := createVethPair("veth", 0, 0)
+			if err != nil {
+				return err
+			}
+			return initializeInterface(n, &NetworkState{VethChild: name2})
+		})
+		if test.valid && err != nil {
+			t.Fatalf("expected gateway %s with on link %v to be valid but received %q", test.gateway, test.onLink, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("expected gateway %s with on link %v to be invalid", test.gateway, test.onLink)
+		}
+	}
+}
+
+func TestInitializeIPv6Only(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		IPv6Address: "fd00:19::2/64",
+		IPv6Gateway: "fd00:19::1",
+		// without an ipv4 address the ipv4 gateway is not applied
+		Gateway: "10.90.0.1",
+	}
+	var (
+		addrs  []net.Addr
+		routes []netlink.Route
+	)
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		iface, err := net.InterfaceByName(defaultDevice)
+		if err != nil {
+			return err
+		}
+		if addrs, err = iface.Addrs(); err != nil {
+			return err
+		}
+		routes, err = netlink.NetworkGetRoutes()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ipv6 bool
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip.To4() != nil {
+			t.Fatalf("expected no ipv4 address but received %s", addr)
+		}
+		if addr.String() == n.IPv6Address {
+			ipv6 = true
+		}
+	}
+	if !ipv6 {
+		t.Fatalf("expected %s to be set but received %v", n.IPv6Address, addrs)
+	}
+	for _, route := range routes {
+		if route.Default {
+			t.Fatal("expected no ipv4 default route")
+		}
+	}
+}
+
+func TestInitializeDerivesMacFromID(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		DeriveMacFromID: true,
+		ContainerID:     "4e6a6e3d1ad5",
+	}
+	var mac string
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		iface, err := net.InterfaceByName(defaultDevice)
+		if err != nil {
+			return err
+		}
+		mac = iface.HardwareAddr.String()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := GenerateMacFromID(n.ContainerID); mac != expected {
+		t.Fatalf("expected mac address to be %s but received %s", expected, mac)
+	}
+}
+
+func TestInitializeSetsArp(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		ArpIgnore:   1,
+		ArpAnnounce: 2,
+	}
+	values := make(map[string]string)
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		for _, key := range []string{"arp_ignore", "arp_announce"} {
+			data, err := ioutil.ReadFile(interfaceSysctlPath("ipv4", defaultDevice, key))
+			if err != nil {
+				return err
+			}
+			values[key] = strings.TrimSpace(string(data))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values["arp_ignore"] != "1" || values["arp_announce"] != "2" {
+		t.Fatalf("expected arp_ignore 1 and arp_announce 2 but received %v", values)
+	}
+}
+
+func TestInitializeResetsInterfaceOnFailure(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		Address: "10.91.0.2/24",
+		// the gateway of the route is not reachable so adding it fails
+		Routes: []Route{{Destination: "10.91.5.0/24", Gateway: "10.91.9.1"}},
+	}
+	var (
+		initErr error
+		flags   net.Flags
+	)
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		initErr = initializeInterface(n, &NetworkState{VethChild: name2})
+
+		if _, err := net.InterfaceByName(defaultDevice); err == nil {
+			return fmt.Errorf("expected %s to be renamed back to %s", defaultDevice, name2)
+		}
+		iface, err := net.InterfaceByName(name2)
+		if err != nil {
+			return err
+		}
+		flags = iface.Flags
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if initErr == nil {
+		t.Fatal("expected error to not be nil with an unreachable route")
+	}
+	if flags&net.FlagUp != 0 {
+		t.Fatal("expected the interface to be left down")
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	configs := []*Network{
+		{
+			Address:     "10.96.0.2/24",
+			IPv6Address: "fd00:1::2/64",
+			IPv6Gateway: "fd00:1::1",
+			Rules:       []Rule{{From: "10.96.0.2", Table: 100, Priority: 1000}},
+		},
+		{
+			Address:     "10.96.1.2/24",
+			IPv6Address: "fd00:2::2/64",
+			IPv6Gateway: "fd00:2::1",
+			Rules:       []Rule{{From: "10.96.1.2", Table: 100, Priority: 1000}},
+		},
+	}
+	var (
+		v     = &Veth{}
+		state = &NetworkState{Rules: configs[0].Rules}
+		addrs []net.Addr
+		out   []byte
+	)
+	err := inNewNetworkNamespace(func() error {
+		_, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		state.Interface = name2
+		if err := InterfaceUp(name2); err != nil {
+			return err
+		}
+		if err := setAddresses(configs[0], name2); err != nil {
+			return err
+		}
+		if err := setRoutes(configs[0], name2, false); err != nil {
+			return err
+		}
+
+		if err := v.Reconfigure(configs[1], state); err != nil {
+			return err
+		}
+		if err := v.Reconfigure(configs[1], state); err != nil {
+			return fmt.Errorf("expected reconfiguring with the same config to succeed but received %q", err)
+		}
+		if err := v.Reconfigure(&Network{Address: "10.96.2.2/24", Gateway: "10.96.3.1"}, state); err == nil {
+			return fmt.Errorf("expected error to not be nil with a gateway outside of the subnet")
+		}
+
+		iface, err := net.InterfaceByName(name2)
+		if err != nil {
+			return err
+		}
+		if addrs, err = iface.Addrs(); err != nil {
+			return err
+		}
+		// commands run on the locked thread and see its namespace
+		if out, err = exec.Command("ip", "-6", "route", "show", "default").CombinedOutput(); err != nil {
+			return fmt.Errorf("unable to list routes: %s: %s", err, out)
+		}
+		rules, err := exec.Command("ip", "rule", "show").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("unable to list rules: %s: %s", err, rules)
+		}
+		out = append(out, rules...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var addresses []string
+	for _, addr := range addrs {
+		if ip, _, err := net.ParseCIDR(addr.String()); err == nil && !ip.IsLinkLocalUnicast() {
+			addresses = append(addresses, addr.String())
+		}
+	}
+	if expected := []string{"10.96.1.2/24", "fd00:2::2/64"}; !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("expected only %v but received %v", expected, addresses)
+	}
+	for _, stale := range []string{"fd00:1::1", "from 10.96.0.2"} {
+		if strings.Contains(string(out), stale) {
+			t.Fatalf("expected %q to be removed but received %q", stale, out)
+		}
+	}
+	for _, current := range []string{"via fd00:2::1", "from 10.96.1.2 lookup 100"} {
+		if !strings.Contains(string(out), current) {
+			t.Fatalf("expected %q to be applied but received %q", current, out)
+		}
+	}
+	if !reflect.DeepEqual(state.Rules, configs[1].Rules) {
+		t.Fatalf("expected the rules in the state to be %v but received %v", configs[1].Rules, state.Rules)
+	}
+}
+
+func TestInitializeFlushesAddresses(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	for _, keep := range []bool{false, true} {
+		n := &Network{
+			Address:       "10.92.1.2/24",
+			KeepAddresses: keep,
+		}
+		var addrs []net.Addr
+		err := inNewNetworkNamespace(func() error {
+			_, name2, err := createVethPair("veth", 0, 0)
+			if err != nil {
+				return err
+			}
+			if err := SetInterfaceIp(name2, "10.92.0.2/24"); err != nil {
+				return err
+			}
+			if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+				return err
+			}
+			iface, err := net.InterfaceByName(defaultDevice)
+			if err != nil {
+				return err
+			}
+			addrs, err = iface.Addrs()
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stale bool
+		for _, addr := range addrs {
+			if addr.String() == "10.92.0.2/24" {
+				stale = true
+			}
+		}
+		if stale != keep {
+			t.Fatalf("expected the existing address to be kept %v but received %v", keep, addrs)
+		}
+	}
+}
+
+func TestWaitForInterfaceUp(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	name1, name2, err := createVethPair("veth", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteInterface(name1)
+
+	// a veth is only operationally up once its peer is up as well
+	if err := InterfaceUp(name2); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitForInterfaceUp(name2, 50*time.Millisecond); err == nil {
+		t.Fatal("expected error to not be nil while the peer is down")
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		InterfaceUp(name1)
+	}()
+	if err := WaitForInterfaceUp(name2, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitializeWaitsForUp(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	n := &Network{
+		InterfaceName: "pa0",
+		WaitForUp:     true,
+	}
+	var waited time.Duration
+	err := inNewNetworkNamespace(func() error {
+		name1, name2, err := createVethPair("veth", 0, 0)
+		if err != nil {
+			return err
+		}
+		// the command runs on the locked thread and brings the peer up in its namespace
+		cmd := exec.Command("sh", "-c", "sleep 0.2 && ip link set "+name1+" up")
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		defer cmd.Wait()
+
+		start := time.Now()
+		if err := initializeInterface(n, &NetworkState{VethChild: name2}); err != nil {
+			return err
+		}
+		waited = time.Since(start)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if waited < 200*time.Millisecond {
+		t.Fatalf("expected Initialize to wait for the peer to be up but it returned after %s", waited)
+	}
+}
+
+func TestCreateWithMtuAboveBridge(t *testing.T) {
+	if testing.Short() {
+		return
+	}
+
+	bridge := "testbr3"
+	if _, err := createBridge(bridge); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteBridge(bridge)
+
+	if err := SetMtu(bridge, 1500); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &Veth{}
+	for _, test := range []struct {
+		mtu    int
+		ignore bool
+		valid  bool
+	}{
+		{1500, false, true},
+		{9000, false, false},
+		{9000, true, true},
+	} {
+		n := &Network{
+			Bridge:          bridge,
+			VethPrefix:      "veth",
+			Mtu:             test.mtu,
+			IgnoreBridgeMtu: test.ignore,
+		}
+
+		// the move into the namespace fails so only check how far Create got
+		state := &NetworkState{}
+		v.Create(n, 1<<30, state)
+		v.Delete(n, state)
+
+		if created := state.VethHost != ""; created != test.valid {
+			t.Fatalf("expected mtu %d with ignore %v to be accepted %v", test.mtu, test.ignore, test.valid)
+		}
+	}
+}